@@ -0,0 +1,361 @@
+package graphics
+
+import (
+	"math"
+	"sort"
+)
+
+// LUT is a lookup table mapping 8-bit channel values to new values. Adjustments built on LUTs are applied directly to
+// Pix, without any color conversion, so they're many times the speed of going through At and Set (compare SetPixel).
+// For 16-bit formats, values are mapped by linearly interpolating between the entries either side of them.
+type LUT [256]uint8
+
+// IdentityLUT returns the LUT which maps every value to itself.
+func IdentityLUT() LUT {
+	var l LUT
+	for i := range l {
+		l[i] = uint8(i)
+	}
+	return l
+}
+
+// lutFromFunc builds a LUT from f, which maps values in [0,1] to values in [0,1] (its results are clamped).
+func lutFromFunc(f func(v float64) float64) LUT {
+	var l LUT
+	for i := range l {
+		v := f(float64(i)/255) * 255
+		l[i] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+	}
+	return l
+}
+
+// Then returns the LUT which applies l and then m.
+func (l LUT) Then(m LUT) LUT {
+	var r LUT
+	for i := range r {
+		r[i] = m[l[i]]
+	}
+	return r
+}
+
+// BrightnessLUT returns the LUT which adds delta (a fraction of the channel range, so -1 to 1) to each value.
+func BrightnessLUT(delta float64) LUT {
+	return lutFromFunc(func(v float64) float64 {
+		return v + delta
+	})
+}
+
+// ContrastLUT returns the LUT which scales each value's distance from mid-gray by factor. A factor of 1 leaves values
+// unchanged, 0 makes everything mid-gray, and factors above 1 increase contrast.
+func ContrastLUT(factor float64) LUT {
+	return lutFromFunc(func(v float64) float64 {
+		return (v-0.5)*factor + 0.5
+	})
+}
+
+// GammaLUT returns the LUT which applies gamma correction: v^(1/gamma), for values in [0,1]. Gammas above 1 lighten
+// the midtones and below 1 darken them. gamma must be > 0.
+func GammaLUT(gamma float64) LUT {
+	return lutFromFunc(func(v float64) float64 {
+		return math.Pow(v, 1/gamma)
+	})
+}
+
+// LevelsLUT returns the LUT for a levels adjustment: input values at or below inBlack map to outBlack, those at or
+// above inWhite map to outWhite, and those between are stretched across the output range with gamma applied as in
+// GammaLUT (1 for none). inWhite must be > inBlack.
+func LevelsLUT(inBlack, inWhite uint8, gamma float64, outBlack, outWhite uint8) LUT {
+	lo, hi := float64(inBlack)/255, float64(inWhite)/255
+	olo, ohi := float64(outBlack)/255, float64(outWhite)/255
+	return lutFromFunc(func(v float64) float64 {
+		v = math.Max(0, math.Min(1, (v-lo)/(hi-lo)))
+		return olo + math.Pow(v, 1/gamma)*(ohi-olo)
+	})
+}
+
+// InvertLUT returns the LUT which inverts values (a photographic negative).
+func InvertLUT() LUT {
+	var l LUT
+	for i := range l {
+		l[i] = uint8(255 - i)
+	}
+	return l
+}
+
+// ThresholdLUT returns the LUT which maps values >= t to 255 and the rest to 0.
+func ThresholdLUT(t uint8) LUT {
+	var l LUT
+	for i := int(t); i < 256; i++ {
+		l[i] = 255
+	}
+	return l
+}
+
+// CurvePoint is a control point of a curve: the input value In maps to Out.
+type CurvePoint struct {
+	In, Out uint8
+}
+
+// CurveLUT returns the LUT for an arbitrary tone curve through points, as in an image editor's curves tool. The curve
+// is a monotone cubic spline (Fritsch-Carlson), so it's smooth but never overshoots between points. It is flat
+// beyond the first and last points. With no points, the identity is returned; with one, the constant.
+// If two points share an input, the later one is used.
+func CurveLUT(points ...CurvePoint) LUT {
+	if len(points) == 0 {
+		return IdentityLUT()
+	}
+	pts := make([]CurvePoint, len(points))
+	copy(pts, points)
+	sort.SliceStable(pts, func(i, j int) bool { return pts[i].In < pts[j].In })
+	// Drop duplicate inputs, keeping the last.
+	n := 0
+	for i := range pts {
+		if n > 0 && pts[n-1].In == pts[i].In {
+			pts[n-1] = pts[i]
+		} else {
+			pts[n] = pts[i]
+			n++
+		}
+	}
+	pts = pts[:n]
+
+	var l LUT
+	if len(pts) == 1 {
+		for i := range l {
+			l[i] = pts[0].Out
+		}
+		return l
+	}
+
+	// Secant slopes, then tangents adjusted to keep each segment monotone.
+	xs, ys := make([]float64, n), make([]float64, n)
+	for i, p := range pts {
+		xs[i], ys[i] = float64(p.In), float64(p.Out)
+	}
+	d := make([]float64, n-1)
+	for i := range d {
+		d[i] = (ys[i+1] - ys[i]) / (xs[i+1] - xs[i])
+	}
+	m := make([]float64, n)
+	m[0], m[n-1] = d[0], d[n-2]
+	for i := 1; i < n-1; i++ {
+		if d[i-1]*d[i] <= 0 {
+			m[i] = 0
+		} else {
+			m[i] = (d[i-1] + d[i]) / 2
+		}
+	}
+	for i := range d {
+		if d[i] == 0 {
+			m[i], m[i+1] = 0, 0
+			continue
+		}
+		a, b := m[i]/d[i], m[i+1]/d[i]
+		if s := a*a + b*b; s > 9 {
+			t := 3 / math.Sqrt(s)
+			m[i], m[i+1] = t*a*d[i], t*b*d[i]
+		}
+	}
+
+	seg := 0
+	for i := range l {
+		x := float64(i)
+		var v float64
+		switch {
+		case x <= xs[0]:
+			v = ys[0]
+		case x >= xs[n-1]:
+			v = ys[n-1]
+		default:
+			for x > xs[seg+1] {
+				seg++
+			}
+			h := xs[seg+1] - xs[seg]
+			t := (x - xs[seg]) / h
+			t2, t3 := t*t, t*t*t
+			v = (2*t3-3*t2+1)*ys[seg] + (t3-2*t2+t)*h*m[seg] + (-2*t3+3*t2)*ys[seg+1] + (t3-t2)*h*m[seg+1]
+		}
+		l[i] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+	}
+	return l
+}
+
+// ApplyLUT maps every color channel of every pixel of img through l, in place. Alpha is left untouched.
+func (img *Image) ApplyLUT(l LUT) {
+	luts := make([]*LUT, img.channels())
+	for c := range luts {
+		luts[c] = &l
+	}
+	img.ApplyChannelLUTs(luts...)
+}
+
+// ApplyChannelLUTs maps channel c of every pixel of img through luts[c], in place. Channels without a LUT (nil, or
+// beyond the end of luts) are left untouched, as is alpha whatever LUT is given for it.
+// For formats with premultiplied alpha (such as image.RGBA), the colors of partially transparent pixels are
+// un-premultiplied before being mapped, so that the result is the same as for the equivalent non-premultiplied
+// image. Rows are processed in parallel.
+func (img *Image) ApplyChannelLUTs(luts ...*LUT) {
+	ch := img.channels()
+	ls := make([]*LUT, ch)
+	copy(ls, luts)
+	if img.alpha >= 0 {
+		ls[img.alpha] = nil
+	}
+	max := img.maxValue()
+
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o = x+1, o+img.bpp {
+				a := max
+				if img.premul && img.alpha >= 0 {
+					if a = img.readChannel(o + img.alpha*img.depth); a == 0 {
+						continue
+					}
+				}
+				if img.depth == 1 && a == max {
+					for c, l := range ls {
+						if l != nil {
+							img.Pix[o+c] = l[img.Pix[o+c]]
+						}
+					}
+					continue
+				}
+				for c, l := range ls {
+					if l != nil {
+						co := o + c*img.depth
+						img.writeChannel(co, l.mapValue(img.readChannel(co)*max/a, max)*a/max)
+					}
+				}
+			}
+		}
+	})
+}
+
+// mapValue maps v, in the range [0,max], through l, interpolating between entries, and returns a value in the same
+// range.
+func (l *LUT) mapValue(v, max float64) float64 {
+	f := math.Max(0, math.Min(255, v*255/max))
+	i := int(f)
+	if i == 255 {
+		return float64(l[255]) * max / 255
+	}
+	t := f - float64(i)
+	return (float64(l[i])*(1-t) + float64(l[i+1])*t) * max / 255
+}
+
+// isRGB returns whether img's channels are red, green, blue and alpha, in that order (as with image.RGBA, NRGBA,
+// RGBA64 and NRGBA64).
+func (img *Image) isRGB() bool {
+	return img.channels() == 4 && img.alpha == 3
+}
+
+// applyColorMatrix replaces the red, green and blue channels of every pixel of img with m times them, in place.
+// Alpha is left untouched. It does nothing if img isn't an RGB format (see isRGB).
+// For 8-bit formats, each of the 9 products is looked up in a 256-entry fixed point table rather than computed.
+// Since the transformation is linear, premultiplied colors can be transformed directly; the results are just capped
+// at alpha.
+func (img *Image) applyColorMatrix(m [3][3]float64) {
+	if !img.isRGB() {
+		return
+	}
+	max := img.maxValue()
+	// tables[i][j][v] is m[i][j]*v, with 8 fractional bits.
+	var tables [3][3][256]int32
+	if img.depth == 1 {
+		for i := range tables {
+			for j := range tables[i] {
+				for v := range tables[i][j] {
+					tables[i][j][v] = int32(math.Round(m[i][j] * float64(v) * 256))
+				}
+			}
+		}
+	}
+
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o = x+1, o+img.bpp {
+				limit := max
+				if img.premul {
+					limit = img.readChannel(o + 3*img.depth)
+				}
+				if img.depth == 1 {
+					p := img.Pix[o : o+3 : o+3]
+					r, g, b := p[0], p[1], p[2]
+					for i := range p {
+						v := (tables[i][0][r] + tables[i][1][g] + tables[i][2][b] + 128) >> 8
+						if v < 0 {
+							v = 0
+						} else if v > int32(limit) {
+							v = int32(limit)
+						}
+						p[i] = uint8(v)
+					}
+					continue
+				}
+				var in [3]float64
+				for j := range in {
+					in[j] = img.readChannel(o + j*2)
+				}
+				for i := range in {
+					v := m[i][0]*in[0] + m[i][1]*in[1] + m[i][2]*in[2]
+					img.writeChannel(o+i*2, math.Min(v, limit))
+				}
+			}
+		}
+	})
+}
+
+// AdjustBrightness applies BrightnessLUT(delta) to img. See ApplyLUT.
+func (img *Image) AdjustBrightness(delta float64) {
+	img.ApplyLUT(BrightnessLUT(delta))
+}
+
+// AdjustContrast applies ContrastLUT(factor) to img. See ApplyLUT.
+func (img *Image) AdjustContrast(factor float64) {
+	img.ApplyLUT(ContrastLUT(factor))
+}
+
+// AdjustGamma applies GammaLUT(gamma) to img. See ApplyLUT.
+func (img *Image) AdjustGamma(gamma float64) {
+	img.ApplyLUT(GammaLUT(gamma))
+}
+
+// AdjustLevels applies LevelsLUT(inBlack, inWhite, gamma, 0, 255) to img. See ApplyLUT.
+func (img *Image) AdjustLevels(inBlack, inWhite uint8, gamma float64) {
+	img.ApplyLUT(LevelsLUT(inBlack, inWhite, gamma, 0, 255))
+}
+
+// Invert inverts the colors of img (leaving alpha untouched). See ApplyLUT.
+func (img *Image) Invert() {
+	img.ApplyLUT(InvertLUT())
+}
+
+// Grayscale converts the colors of img to their luma (Rec. 601: 0.299R + 0.587G + 0.114B), in place, leaving alpha
+// untouched. It does nothing to formats other than RGBA, NRGBA, RGBA64 and NRGBA64; in particular, image.Gray is
+// already grayscale.
+func (img *Image) Grayscale() {
+	img.applyColorMatrix([3][3]float64{
+		{0.299, 0.587, 0.114},
+		{0.299, 0.587, 0.114},
+		{0.299, 0.587, 0.114},
+	})
+}
+
+// Sepia gives img a sepia tone, in place, leaving alpha untouched. Like Grayscale, it does nothing to formats which
+// aren't RGB.
+func (img *Image) Sepia() {
+	img.applyColorMatrix([3][3]float64{
+		{0.393, 0.769, 0.189},
+		{0.349, 0.686, 0.168},
+		{0.272, 0.534, 0.131},
+	})
+}
+
+// Threshold makes every pixel of img black or white, in place, according to whether its luma (see Grayscale) is
+// below t or not. Alpha is left untouched. For single-channel formats, the channel itself is thresholded.
+func (img *Image) Threshold(t uint8) {
+	img.Grayscale()
+	img.ApplyLUT(ThresholdLUT(t))
+}
@@ -0,0 +1,496 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// The single-color conversion functions below work with RGB components in [0,1], and are for sRGB with a D65 white
+// point. Hues are in degrees, in [0,360).
+
+// RGBToHSV converts an RGB color to hue, saturation and value (each of the latter in [0,1]).
+func RGBToHSV(r, g, b float64) (h, s, v float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	v = max
+	if max > 0 {
+		s = (max - min) / max
+	}
+	return hue(r, g, b, max, min), s, v
+}
+
+// HSVToRGB converts a hue, saturation and value color to RGB.
+func HSVToRGB(h, s, v float64) (r, g, b float64) {
+	c := v * s
+	return hueToRGB(h, c, v-c)
+}
+
+// RGBToHSL converts an RGB color to hue, saturation and lightness (each of the latter in [0,1]).
+func RGBToHSL(r, g, b float64) (h, s, l float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	if d := max - min; d > 0 {
+		s = d / (1 - math.Abs(2*l-1))
+	}
+	return hue(r, g, b, max, min), s, l
+}
+
+// HSLToRGB converts a hue, saturation and lightness color to RGB.
+func HSLToRGB(h, s, l float64) (r, g, b float64) {
+	c := (1 - math.Abs(2*l-1)) * s
+	return hueToRGB(h, c, l-c/2)
+}
+
+// hue returns the hue shared by HSV and HSL of the color r,g,b, whose largest and smallest components are max and
+// min. Grays have a hue of 0.
+func hue(r, g, b, max, min float64) float64 {
+	d := max - min
+	if d == 0 {
+		return 0
+	}
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// hueToRGB returns the RGB color with hue h, chroma c and m added to each component.
+func hueToRGB(h, c, m float64) (r, g, b float64) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	hp := h / 60
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+	switch int(hp) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return r + m, g + m, b + m
+}
+
+// SRGBToLinear converts an sRGB component in [0,1] to linear light.
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB converts a linear light component in [0,1] to sRGB.
+func LinearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// The D65 reference white, in XYZ.
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// RGBToLab converts an RGB color to CIE L*a*b*. L is in [0,100], and a and b are roughly in [-128,127].
+func RGBToLab(r, g, b float64) (l, a, bb float64) {
+	r, g, b = SRGBToLinear(r), SRGBToLinear(g), SRGBToLinear(b)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+// LabToRGB converts a CIE L*a*b* color to RGB. Colors outside the sRGB gamut give components outside [0,1]; clamp
+// them if need be.
+func LabToRGB(l, a, bb float64) (r, g, b float64) {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - bb/200
+	x, y, z := labFInv(fx)*whiteX, labFInv(fy)*whiteY, labFInv(fz)*whiteZ
+	r = 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g = -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b = 0.0556434*x - 0.2040259*y + 1.0572252*z
+	return linearToSRGBSigned(r), linearToSRGBSigned(g), linearToSRGBSigned(b)
+}
+
+// linearToSRGBSigned is LinearToSRGB, mirrored for negative values so out of gamut colors round trip.
+func linearToSRGBSigned(v float64) float64 {
+	if v < 0 {
+		return -LinearToSRGB(-v)
+	}
+	return LinearToSRGB(v)
+}
+
+const (
+	labEpsilon = 216.0 / 24389
+	labKappa   = 24389.0 / 27
+)
+
+func labF(t float64) float64 {
+	if t > labEpsilon {
+		return math.Cbrt(t)
+	}
+	return (labKappa*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > labEpsilon {
+		return t3
+	}
+	return (116*t - 16) / labKappa
+}
+
+// LabToLCh converts a CIE L*a*b* color to its cylindrical form, lightness, chroma and hue.
+func LabToLCh(l, a, b float64) (ll, c, h float64) {
+	c = math.Hypot(a, b)
+	h = math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return l, c, h
+}
+
+// LChToLab converts a CIE LCh color to L*a*b*.
+func LChToLab(l, c, h float64) (ll, a, b float64) {
+	sin, cos := math.Sincos(h * math.Pi / 180)
+	return l, c * cos, c * sin
+}
+
+// RGBToYCbCr converts an RGB color to full-range (JPEG) BT.601 Y'CbCr, with each component in [0,1] and Cb and Cr
+// centered on 0.5. It is the floating point equivalent of color.RGBToYCbCr.
+func RGBToYCbCr(r, g, b float64) (y, cb, cr float64) {
+	y = 0.299*r + 0.587*g + 0.114*b
+	cb = -0.168736*r - 0.331264*g + 0.5*b + 0.5
+	cr = 0.5*r - 0.418688*g - 0.081312*b + 0.5
+	return y, cb, cr
+}
+
+// YCbCrToRGB converts a full-range BT.601 Y'CbCr color (see RGBToYCbCr) to RGB.
+func YCbCrToRGB(y, cb, cr float64) (r, g, b float64) {
+	cb, cr = cb-0.5, cr-0.5
+	return y + 1.402*cr, y - 0.344136*cb - 0.714136*cr, y + 1.772*cb
+}
+
+// DeltaE76 returns the CIE76 color difference between two L*a*b* colors: their Euclidean distance. A difference of
+// about 2.3 is just noticeable. It is cheap, but overstates differences between saturated colors; DeltaE2000 is more
+// perceptually uniform.
+func DeltaE76(l1, a1, b1, l2, a2, b2 float64) float64 {
+	dl, da, db := l1-l2, a1-a2, b1-b2
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// DeltaE2000 returns the CIEDE2000 color difference between two L*a*b* colors, the current CIE standard for
+// perceptual color distance.
+// This follows Sharma, Wu and Dalal, "The CIEDE2000 Color-Difference Formula: Implementation Notes, Supplementary
+// Test Data, and Mathematical Observations" (2005).
+func DeltaE2000(l1, a1, b1, l2, a2, b2 float64) float64 {
+	const deg = math.Pi / 180
+	pow25_7 := math.Pow(25, 7)
+
+	cBar := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2
+	cBar7 := math.Pow(cBar, 7)
+	g := 0.5 * (1 - math.Sqrt(cBar7/(cBar7+pow25_7)))
+	a1p, a2p := (1+g)*a1, (1+g)*a2
+	c1p, c2p := math.Hypot(a1p, b1), math.Hypot(a2p, b2)
+	h1p, h2p := primeHue(a1p, b1), primeHue(a2p, b2)
+
+	dLp := l2 - l1
+	dCp := c2p - c1p
+	var dhp float64
+	if c1p*c2p != 0 {
+		dhp = h2p - h1p
+		if dhp > 180 {
+			dhp -= 360
+		} else if dhp < -180 {
+			dhp += 360
+		}
+	}
+	dHp := 2 * math.Sqrt(c1p*c2p) * math.Sin(dhp/2*deg)
+
+	lBarP := (l1 + l2) / 2
+	cBarP := (c1p + c2p) / 2
+	hBarP := h1p + h2p
+	if c1p*c2p != 0 {
+		if math.Abs(h1p-h2p) <= 180 {
+			hBarP /= 2
+		} else if hBarP < 360 {
+			hBarP = (hBarP + 360) / 2
+		} else {
+			hBarP = (hBarP - 360) / 2
+		}
+	}
+
+	t := 1 - 0.17*math.Cos((hBarP-30)*deg) + 0.24*math.Cos(2*hBarP*deg) + 0.32*math.Cos((3*hBarP+6)*deg) -
+		0.20*math.Cos((4*hBarP-63)*deg)
+	dTheta := 30 * math.Exp(-math.Pow((hBarP-275)/25, 2))
+	cBarP7 := math.Pow(cBarP, 7)
+	rC := 2 * math.Sqrt(cBarP7/(cBarP7+pow25_7))
+	l50 := (lBarP - 50) * (lBarP - 50)
+	sL := 1 + 0.015*l50/math.Sqrt(20+l50)
+	sC := 1 + 0.045*cBarP
+	sH := 1 + 0.015*cBarP*t
+	rT := -math.Sin(2*dTheta*deg) * rC
+
+	l, c, h := dLp/sL, dCp/sC, dHp/sH
+	return math.Sqrt(l*l + c*c + h*h + rT*c*h)
+}
+
+// primeHue returns the hue angle, in degrees in [0,360), used by DeltaE2000.
+func primeHue(a, b float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// ColorSpace identifies the color space of a PlanarImage's color planes.
+type ColorSpace int
+
+const (
+	// SpaceRGB planes are sRGB red, green and blue, in [0,1].
+	SpaceRGB ColorSpace = iota
+	// SpaceHSV planes are hue (degrees), saturation and value. See RGBToHSV.
+	SpaceHSV
+	// SpaceHSL planes are hue (degrees), saturation and lightness. See RGBToHSL.
+	SpaceHSL
+	// SpaceLab planes are CIE L*, a* and b*. See RGBToLab.
+	SpaceLab
+	// SpaceLCh planes are CIE lightness, chroma and hue (degrees). See LabToLCh.
+	SpaceLCh
+	// SpaceYCbCr planes are full-range BT.601 Y', Cb and Cr. See RGBToYCbCr.
+	SpaceYCbCr
+)
+
+// String returns the name of the color space.
+func (s ColorSpace) String() string {
+	switch s {
+	case SpaceRGB:
+		return "RGB"
+	case SpaceHSV:
+		return "HSV"
+	case SpaceHSL:
+		return "HSL"
+	case SpaceLab:
+		return "Lab"
+	case SpaceLCh:
+		return "LCh"
+	case SpaceYCbCr:
+		return "YCbCr"
+	}
+	return fmt.Sprintf("ColorSpace(%d)", int(s))
+}
+
+// toRGB converts a color in space s to RGB.
+func (s ColorSpace) toRGB(c0, c1, c2 float64) (r, g, b float64) {
+	switch s {
+	case SpaceHSV:
+		return HSVToRGB(c0, c1, c2)
+	case SpaceHSL:
+		return HSLToRGB(c0, c1, c2)
+	case SpaceLab:
+		return LabToRGB(c0, c1, c2)
+	case SpaceLCh:
+		return LabToRGB(LChToLab(c0, c1, c2))
+	case SpaceYCbCr:
+		return YCbCrToRGB(c0, c1, c2)
+	}
+	return c0, c1, c2
+}
+
+// fromRGB converts an RGB color to space s.
+func (s ColorSpace) fromRGB(r, g, b float64) (c0, c1, c2 float64) {
+	switch s {
+	case SpaceHSV:
+		return RGBToHSV(r, g, b)
+	case SpaceHSL:
+		return RGBToHSL(r, g, b)
+	case SpaceLab:
+		return RGBToLab(r, g, b)
+	case SpaceLCh:
+		return LabToLCh(RGBToLab(r, g, b))
+	case SpaceYCbCr:
+		return RGBToYCbCr(r, g, b)
+	}
+	return r, g, b
+}
+
+// PlanarImage is an image stored as float32 planes in some ColorSpace, for processing which needs more than
+// (or different) 8 or 16-bit RGB channels: color segmentation, perceptual color distance, etc.
+type PlanarImage struct {
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+	// Space is the color space of the first three planes.
+	Space ColorSpace
+	// Planes holds the three color planes and then the alpha plane (in [0,1]; straight, not premultiplied), each
+	// Rect.Dx()*Rect.Dy() values in row-major order.
+	Planes [4][]float32
+}
+
+// NewPlanarImage returns a PlanarImage holding img converted to space. Colors are un-premultiplied. RGB and gray
+// formats are read directly from Pix; others go through img.At.
+// Rows are processed in parallel.
+func NewPlanarImage(img *Image, space ColorSpace) *PlanarImage {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	p := &PlanarImage{Rect: img.Rect, Space: space}
+	for i := range p.Planes {
+		p.Planes[i] = make([]float32, w*h)
+	}
+	max := img.maxValue()
+	gray := img.isGray()
+	parallelRows(0, h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, img.Rect.Min.Y+y)
+			for x := 0; x < w; x, o = x+1, o+img.bpp {
+				var r, g, b, a float64
+				switch {
+				case img.isRGB():
+					a = img.readChannel(o+3*img.depth) / max
+					r = img.readChannel(o) / max
+					g = img.readChannel(o+img.depth) / max
+					b = img.readChannel(o+2*img.depth) / max
+					if img.premul {
+						if a > 0 {
+							r, g, b = r/a, g/a, b/a
+						} else {
+							r, g, b = 0, 0, 0
+						}
+					}
+				case gray:
+					r = img.readChannel(o) / max
+					g, b, a = r, r, 1
+				default:
+					c := color.NRGBA64Model.Convert(img.At(img.Rect.Min.X+x, img.Rect.Min.Y+y)).(color.NRGBA64)
+					r, g, b, a = float64(c.R)/65535, float64(c.G)/65535, float64(c.B)/65535, float64(c.A)/65535
+				}
+				c0, c1, c2 := space.fromRGB(r, g, b)
+				i := y*w + x
+				p.Planes[0][i], p.Planes[1][i], p.Planes[2][i], p.Planes[3][i] =
+					float32(c0), float32(c1), float32(c2), float32(a)
+			}
+		}
+	})
+	return p
+}
+
+// Convert converts p to space, in place.
+func (p *PlanarImage) Convert(space ColorSpace) {
+	if space == p.Space {
+		return
+	}
+	from := p.Space
+	parallelRows(0, p.Rect.Dy(), func(y0, y1 int) {
+		w := p.Rect.Dx()
+		for i := y0 * w; i < y1*w; i++ {
+			r, g, b := from.toRGB(float64(p.Planes[0][i]), float64(p.Planes[1][i]), float64(p.Planes[2][i]))
+			c0, c1, c2 := space.fromRGB(r, g, b)
+			p.Planes[0][i], p.Planes[1][i], p.Planes[2][i] = float32(c0), float32(c1), float32(c2)
+		}
+	})
+	p.Space = space
+}
+
+// At returns the three color components and alpha of the pixel at (x, y), which must be within p.Rect.
+func (p *PlanarImage) At(x, y int) (c0, c1, c2, a float64) {
+	i := (y-p.Rect.Min.Y)*p.Rect.Dx() + x - p.Rect.Min.X
+	return float64(p.Planes[0][i]), float64(p.Planes[1][i]), float64(p.Planes[2][i]), float64(p.Planes[3][i])
+}
+
+// SetFromPlanar sets the pixels of img within the intersection of the images' bounds from p, converting them back to
+// RGB (clamped to [0,1]) and then img's format. Gray formats get the luma. RGB and gray formats are written
+// directly to Pix; others go through img.Set. Rows are processed in parallel.
+func (img *Image) SetFromPlanar(p *PlanarImage) {
+	r := img.Rect.Intersect(p.Rect)
+	max := img.maxValue()
+	gray := img.isGray()
+	pw := p.Rect.Dx()
+	parallelRows(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(r.Min.X, y)
+			i := (y-p.Rect.Min.Y)*pw + r.Min.X - p.Rect.Min.X
+			for x := r.Min.X; x < r.Max.X; x, o, i = x+1, o+img.bpp, i+1 {
+				cr, cg, cb := p.Space.toRGB(float64(p.Planes[0][i]), float64(p.Planes[1][i]), float64(p.Planes[2][i]))
+				cr, cg, cb = clamp01(cr), clamp01(cg), clamp01(cb)
+				a := clamp01(float64(p.Planes[3][i]))
+				switch {
+				case img.isRGB():
+					if img.premul {
+						cr, cg, cb = cr*a, cg*a, cb*a
+					}
+					img.writeChannel(o, cr*max)
+					img.writeChannel(o+img.depth, cg*max)
+					img.writeChannel(o+2*img.depth, cb*max)
+					img.writeChannel(o+3*img.depth, a*max)
+				case gray:
+					img.writeChannel(o, (0.299*cr+0.587*cg+0.114*cb)*max)
+				default:
+					img.Set(x, y, color.NRGBA64{R: uint16(cr*65535 + 0.5), G: uint16(cg*65535 + 0.5),
+						B: uint16(cb*65535 + 0.5), A: uint16(a*65535 + 0.5)})
+				}
+			}
+		}
+	})
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// AdjustHSL shifts the hue of every pixel of img by hueShift degrees, multiplies its HSL saturation by saturation
+// (so 1 leaves it unchanged and 0 gives grays) and adds lightness (in [-1,1]) to its HSL lightness, in place.
+// Alpha is left untouched. Like Grayscale, it only affects RGB formats. Rows are processed in parallel.
+func (img *Image) AdjustHSL(hueShift, saturation, lightness float64) {
+	if !img.isRGB() {
+		return
+	}
+	max := img.maxValue()
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o = x+1, o+img.bpp {
+				a := 1.0
+				if img.premul {
+					if a = img.readChannel(o+3*img.depth) / max; a == 0 {
+						continue
+					}
+				}
+				r := img.readChannel(o) / max / a
+				g := img.readChannel(o+img.depth) / max / a
+				b := img.readChannel(o+2*img.depth) / max / a
+				h, s, l := RGBToHSL(r, g, b)
+				r, g, b = HSLToRGB(h+hueShift, clamp01(s*saturation), clamp01(l+lightness))
+				img.writeChannel(o, r*a*max)
+				img.writeChannel(o+img.depth, g*a*max)
+				img.writeChannel(o+2*img.depth, b*a*max)
+			}
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package graphics
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+)
+
+// BlendMode selects how a layer's colors combine with those beneath it. The modes follow the W3C Compositing and
+// Blending spec: each blends a channel of the layer (Cs) with the backdrop (Cb), both in [0,1], and the result is
+// then composited source-over, so where either is transparent the other shows through unchanged.
+type BlendMode int
+
+const (
+	// BlendNormal shows the layer over the backdrop.
+	BlendNormal BlendMode = iota
+	// BlendMultiply multiplies the channels (Cb * Cs), which always darkens, like overlaid transparencies.
+	BlendMultiply
+	// BlendScreen inverts, multiplies and inverts again (1 - (1-Cb)(1-Cs)), which always lightens.
+	BlendScreen
+	// BlendOverlay multiplies or screens depending on the backdrop, increasing its contrast.
+	BlendOverlay
+	// BlendDarken takes the smaller channel.
+	BlendDarken
+	// BlendLighten takes the larger channel.
+	BlendLighten
+	// BlendColorDodge brightens the backdrop to reflect the layer (Cb / (1-Cs)).
+	BlendColorDodge
+	// BlendColorBurn darkens the backdrop to reflect the layer (1 - (1-Cb) / Cs).
+	BlendColorBurn
+	// BlendDifference takes the absolute difference of the channels.
+	BlendDifference
+	// BlendAdditive adds the channels, clamped to 1 (also called linear dodge).
+	BlendAdditive
+)
+
+// String returns the name of m, as used in CSS's mix-blend-mode (with "additive" for BlendAdditive).
+func (m BlendMode) String() string {
+	switch m {
+	case BlendNormal:
+		return "normal"
+	case BlendMultiply:
+		return "multiply"
+	case BlendScreen:
+		return "screen"
+	case BlendOverlay:
+		return "overlay"
+	case BlendDarken:
+		return "darken"
+	case BlendLighten:
+		return "lighten"
+	case BlendColorDodge:
+		return "color-dodge"
+	case BlendColorBurn:
+		return "color-burn"
+	case BlendDifference:
+		return "difference"
+	case BlendAdditive:
+		return "additive"
+	}
+	return "unknown"
+}
+
+// blend returns the blend of the backdrop channel cb and source channel cs under m.
+func (m BlendMode) blend(cb, cs float64) float64 {
+	switch m {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		if cb <= 0.5 {
+			return 2 * cb * cs
+		}
+		return 1 - 2*(1-cb)*(1-cs)
+	case BlendDarken:
+		return math.Min(cb, cs)
+	case BlendLighten:
+		return math.Max(cb, cs)
+	case BlendColorDodge:
+		if cb == 0 {
+			return 0
+		}
+		if cs >= 1 {
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	case BlendColorBurn:
+		if cb >= 1 {
+			return 1
+		}
+		if cs == 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	case BlendDifference:
+		return math.Abs(cb - cs)
+	case BlendAdditive:
+		return math.Min(1, cb+cs)
+	}
+	return cs
+}
+
+// Layer is an image to be composited, with how to do so.
+type Layer struct {
+	Image *Image
+	// Offset is added to the layer's coordinates to give those of the destination, so the layer's pixel at (x, y) is
+	// composited onto the destination's at (x, y) + Offset.
+	Offset image.Point
+	// Opacity scales the layer's alpha, from 0 (invisible) to 1.
+	Opacity float64
+	// Visible is whether the layer is composited at all.
+	Visible bool
+	Mode    BlendMode
+}
+
+// NewLayer returns a visible, fully opaque layer of img with BlendNormal and no offset.
+func NewLayer(img *Image) *Layer {
+	return &Layer{Image: img, Opacity: 1, Visible: true}
+}
+
+// Flatten composites layers, bottom first, onto a new, transparent image with bounds r, and returns it. The new image
+// has the same underlying type as the first layer's image if that is an RGB format, and is an image.NRGBA otherwise.
+// See Composite.
+func Flatten(r image.Rectangle, layers ...*Layer) (*Image, error) {
+	var dst *Image
+	var err error
+	if len(layers) > 0 && layers[0].Image.isRGB() {
+		dst, err = NewImageLike(layers[0].Image, r)
+	} else {
+		dst, err = NewImage(image.NewNRGBA(r))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dst, dst.Composite(layers...)
+}
+
+// Composite composites layers, bottom first, onto img (which acts as the bottom-most backdrop), in place. img must be
+// an RGB format; layers may be any format, with those other than RGB and gray formats read via At. Hidden layers and
+// those with no opacity are skipped, and layers only affect the part of img they overlap.
+// Where a layer is BlendNormal, fully opaque and the same image type as img, its rows are copied straight across, as
+// with PlaceAtPoint (falling back to blending for rows with any transparency); otherwise rows are blended in parallel.
+func (img *Image) Composite(layers ...*Layer) error {
+	if !img.isRGB() {
+		return errors.New("composite destination must be an RGB format")
+	}
+	for _, l := range layers {
+		if !l.Visible || l.Opacity <= 0 || l.Image == nil {
+			continue
+		}
+		r := l.Image.Rect.Add(l.Offset).Intersect(img.Rect)
+		if r.Empty() {
+			continue
+		}
+		img.compositeLayer(l, r)
+	}
+	return nil
+}
+
+// compositeLayer composites l onto the part r (in img's coordinates) of img.
+func (img *Image) compositeLayer(l *Layer, r image.Rectangle) {
+	src := l.Image
+	opacity := math.Min(1, l.Opacity)
+	copyable := l.Mode == BlendNormal && opacity == 1 &&
+		reflect.TypeOf(src.Imager) == reflect.TypeOf(img.Imager) && src.bpp == img.bpp
+	n := r.Dx() * img.bpp
+	parallelRows(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			so := src.offset(r.Min.X-l.Offset.X, y-l.Offset.Y)
+			do := img.offset(r.Min.X, y)
+			if copyable && src.rowOpaque(so, r.Dx()) {
+				copy(img.Pix[do:do+n], src.Pix[so:so+n])
+				continue
+			}
+			for x := r.Min.X; x < r.Max.X; x, so, do = x+1, so+src.bpp, do+img.bpp {
+				cs := src.straightAt(so, x-l.Offset.X, y-l.Offset.Y)
+				as := cs[3] * opacity
+				if as == 0 {
+					continue
+				}
+				cb := img.straightAt(do, x, y)
+				ab := cb[3]
+				ao := as + ab*(1-as)
+				var out [4]float64
+				for c := 0; c < 3; c++ {
+					// Where the backdrop is transparent the layer's own color shows, and otherwise the blend does.
+					mixed := (1-ab)*cs[c] + ab*l.Mode.blend(cb[c], cs[c])
+					out[c] = (as*mixed + ab*cb[c]*(1-as)) / ao
+				}
+				out[3] = ao
+				img.setStraight(do, out)
+			}
+		}
+	})
+}
+
+// rowOpaque returns whether the n pixels starting at offset o are all fully opaque.
+func (img *Image) rowOpaque(o, n int) bool {
+	if img.alpha < 0 {
+		return true
+	}
+	for i := 0; i < n; i, o = i+1, o+img.bpp {
+		a := o + img.alpha*img.depth
+		if img.Pix[a] != 0xff || (img.depth == 2 && img.Pix[a+1] != 0xff) {
+			return false
+		}
+	}
+	return true
+}
+
+// straightAt returns the pixel at offset o (and coordinates (x, y)) as straight (non-premultiplied) RGBA, with each
+// channel in [0,1]. RGB and gray formats are read directly from Pix; others go through At.
+func (img *Image) straightAt(o, x, y int) [4]float64 {
+	max := img.maxValue()
+	switch {
+	case img.isRGB():
+		c := [4]float64{img.readChannel(o) / max, img.readChannel(o+img.depth) / max,
+			img.readChannel(o+2*img.depth) / max, img.readChannel(o+3*img.depth) / max}
+		if img.premul && c[3] != 1 {
+			if c[3] == 0 {
+				return [4]float64{}
+			}
+			c[0], c[1], c[2] = c[0]/c[3], c[1]/c[3], c[2]/c[3]
+		}
+		return c
+	case img.isGray():
+		v := img.readChannel(o) / max
+		return [4]float64{v, v, v, 1}
+	}
+	c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+	return [4]float64{float64(c.R) / 65535, float64(c.G) / 65535, float64(c.B) / 65535, float64(c.A) / 65535}
+}
+
+// setStraight stores the straight RGBA color c (with channels in [0,1]) at offset o of an RGB format image,
+// premultiplying it if need be.
+func (img *Image) setStraight(o int, c [4]float64) {
+	max := img.maxValue()
+	a := 1.0
+	if img.premul {
+		a = c[3]
+	}
+	for ch := 0; ch < 3; ch++ {
+		img.writeChannel(o+ch*img.depth, c[ch]*a*max)
+	}
+	img.writeChannel(o+3*img.depth, c[3]*max)
+}
@@ -0,0 +1,536 @@
+package graphics
+
+import (
+	"errors"
+	"math"
+)
+
+// Kernel is a 2D convolution kernel. Weights holds Width*Height weights in row-major order, and the kernel is
+// anchored (centered) at (Width/2, Height/2), so odd sizes are the norm.
+// Kernels are applied without flipping (strictly speaking, as a correlation), as most image processing tools do; this
+// only makes a difference for asymmetric kernels, such as SobelXKernel's, which respond positively to values
+// increasing left to right.
+type Kernel struct {
+	Width, Height int
+	Weights       []float64
+}
+
+// SeparableKernel is a 2D convolution kernel which is the outer product of a horizontal and a vertical 1D kernel,
+// so it can be applied as two 1D passes: O(len(X)+len(Y)) work per pixel instead of O(len(X)*len(Y)).
+// Each is anchored at len/2.
+type SeparableKernel struct {
+	X, Y []float64
+}
+
+// NewKernel returns a width x height Kernel with the given (row-major) weights. If width*height weights aren't
+// provided, an error is returned.
+func NewKernel(width, height int, weights ...float64) (Kernel, error) {
+	if width <= 0 || height <= 0 || len(weights) != width*height {
+		return Kernel{}, errors.New("kernel needs width*height (> 0) weights")
+	}
+	return Kernel{Width: width, Height: height, Weights: weights}, nil
+}
+
+// Normalized returns a copy of k whose weights are scaled to sum to 1. If they sum to 0 (as with edge detection
+// kernels), k is returned unchanged.
+func (k Kernel) Normalized() Kernel {
+	var sum float64
+	for _, w := range k.Weights {
+		sum += w
+	}
+	if sum == 0 {
+		return k
+	}
+	n := Kernel{Width: k.Width, Height: k.Height, Weights: make([]float64, len(k.Weights))}
+	for i, w := range k.Weights {
+		n.Weights[i] = w / sum
+	}
+	return n
+}
+
+// Kernel returns the full 2D Kernel equivalent to k.
+func (k SeparableKernel) Kernel() Kernel {
+	full := Kernel{Width: len(k.X), Height: len(k.Y), Weights: make([]float64, len(k.X)*len(k.Y))}
+	for j, wy := range k.Y {
+		for i, wx := range k.X {
+			full.Weights[j*len(k.X)+i] = wx * wy
+		}
+	}
+	return full
+}
+
+// BoxBlurKernel returns the separable kernel averaging the (2*radius+1)^2 pixel square around each pixel.
+func BoxBlurKernel(radius int) SeparableKernel {
+	if radius < 0 {
+		radius = 0
+	}
+	w := make([]float64, 2*radius+1)
+	for i := range w {
+		w[i] = 1 / float64(len(w))
+	}
+	return SeparableKernel{X: w, Y: w}
+}
+
+// GaussianKernel returns the separable Gaussian blur kernel with standard deviation sigma (in pixels), truncated at
+// 3 sigma (which holds >99.7% of the weight) and normalized. If sigma <= 0, the identity kernel is returned.
+func GaussianKernel(sigma float64) SeparableKernel {
+	if sigma <= 0 {
+		return SeparableKernel{X: []float64{1}, Y: []float64{1}}
+	}
+	r := int(math.Ceil(3 * sigma))
+	w := make([]float64, 2*r+1)
+	var sum float64
+	for i := range w {
+		d := float64(i - r)
+		w[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += w[i]
+	}
+	for i := range w {
+		w[i] /= sum
+	}
+	return SeparableKernel{X: w, Y: w}
+}
+
+// SharpenKernel returns the 3x3 sharpening kernel which adds amount times the (4-neighbor) Laplacian edge response
+// to each pixel. An amount of 1 gives the classic 0,-1,0 / -1,5,-1 / 0,-1,0 kernel.
+func SharpenKernel(amount float64) Kernel {
+	a := -amount
+	return Kernel{Width: 3, Height: 3, Weights: []float64{
+		0, a, 0,
+		a, 1 - 4*a, a,
+		0, a, 0,
+	}}
+}
+
+// EmbossKernel returns a 3x3 emboss kernel, lit from the top left. It sums to 1, so flat areas keep their color
+// while edges facing the light are lightened and those facing away darkened.
+func EmbossKernel() Kernel {
+	return Kernel{Width: 3, Height: 3, Weights: []float64{
+		-2, -1, 0,
+		-1, 1, 1,
+		0, 1, 2,
+	}}
+}
+
+// SobelXKernel returns the 3x3 Sobel kernel for the horizontal gradient (positive where values increase to the
+// right).
+func SobelXKernel() Kernel {
+	return Kernel{Width: 3, Height: 3, Weights: []float64{
+		-1, 0, 1,
+		-2, 0, 2,
+		-1, 0, 1,
+	}}
+}
+
+// SobelYKernel returns the 3x3 Sobel kernel for the vertical gradient (positive where values increase downward).
+func SobelYKernel() Kernel {
+	return Kernel{Width: 3, Height: 3, Weights: []float64{
+		-1, -2, -1,
+		0, 0, 0,
+		1, 2, 1,
+	}}
+}
+
+// LaplacianKernel returns the 3x3 Laplacian kernel. If diagonals is true, the 8-neighbor version is returned,
+// otherwise the 4-neighbor version. Its response is signed, so it's usually applied with Abs or a Bias.
+func LaplacianKernel(diagonals bool) Kernel {
+	if diagonals {
+		return Kernel{Width: 3, Height: 3, Weights: []float64{
+			1, 1, 1,
+			1, -8, 1,
+			1, 1, 1,
+		}}
+	}
+	return Kernel{Width: 3, Height: 3, Weights: []float64{
+		0, 1, 0,
+		1, -4, 1,
+		0, 1, 0,
+	}}
+}
+
+// ConvolveOptions configures convolution. The zero value clamps at the edges and convolves every channel, which is
+// right for blurs.
+type ConvolveOptions struct {
+	// Edge is how pixels beyond the source image's edges are read.
+	Edge EdgeMode
+	// Constant holds the pixelBytes read beyond the edges when Edge is EdgeConstant. As with SetPixel, only the
+	// first n bytes of a pixel may be provided.
+	Constant []uint8
+	// PreserveAlpha, if true, copies the alpha channel from the source rather than convolving it. This is what's
+	// wanted for edge detection and other kernels which don't sum to 1, which would otherwise wipe out alpha.
+	PreserveAlpha bool
+	// Abs, if true, stores the absolute value of each result, so negative responses (as from edge detection kernels)
+	// aren't clamped to 0.
+	Abs bool
+	// Bias is added to each result (after Abs), as a fraction of the channel range; 0.5 centers signed responses on
+	// mid-gray.
+	Bias float64
+}
+
+// Convolve returns a new Image, of the same underlying type and bounds as src, holding src convolved with k.
+// See ConvolveFrom.
+func Convolve(src *Image, k Kernel, opts ConvolveOptions) (*Image, error) {
+	dst, err := NewImageLike(src, src.Rect)
+	if err != nil {
+		return nil, err
+	}
+	dst.ConvolveFrom(src, k, opts)
+	return dst, nil
+}
+
+// ConvolveSeparable returns a new Image, of the same underlying type and bounds as src, holding src convolved with
+// k. See ConvolveSeparableFrom.
+func ConvolveSeparable(src *Image, k SeparableKernel, opts ConvolveOptions) (*Image, error) {
+	dst, err := NewImageLike(src, src.Rect)
+	if err != nil {
+		return nil, err
+	}
+	dst.ConvolveSeparableFrom(src, k, opts)
+	return dst, nil
+}
+
+// ConvolveFrom sets img to src convolved with k. img and src must have the same underlying image type and bounds,
+// and must not be the same Image (or share pixel data).
+// Each channel is convolved separately, with 16-bit channels handled at full precision. If the format has a
+// non-premultiplied alpha channel (as image.NRGBA does) which is being convolved, the colors are premultiplied for
+// the convolution, so that transparent pixels don't bleed their (invisible) color into their neighbors.
+// Rows are processed in parallel.
+// If k is separable, ConvolveSeparableFrom is much faster.
+func (img *Image) ConvolveFrom(src *Image, k Kernel, opts ConvolveOptions) {
+	c := newConvolution(src, opts, k.Width/2, k.Height/2, k.Width-1-k.Width/2, k.Height-1-k.Height/2)
+	ch, w := c.ch, c.w
+	parallelRows(0, c.h, func(y0, y1 int) {
+		acc := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				for i := range acc {
+					acc[i] = 0
+				}
+				for j := 0; j < k.Height; j++ {
+					row := c.rows[y+j]
+					kw := k.Weights[j*k.Width : (j+1)*k.Width]
+					for i, wt := range kw {
+						if wt == 0 {
+							continue
+						}
+						p := c.pixel(c.cols[x+i], row)
+						for ci := 0; ci < ch; ci++ {
+							acc[ci] += wt * float64(p[ci])
+						}
+					}
+				}
+				c.store(img, x, y, acc)
+			}
+		}
+	})
+}
+
+// ConvolveSeparableFrom sets img to src convolved with k, as a horizontal pass followed by a vertical one.
+// Otherwise, it behaves exactly as ConvolveFrom does with k.Kernel() (up to floating point rounding).
+func (img *Image) ConvolveSeparableFrom(src *Image, k SeparableKernel, opts ConvolveOptions) {
+	rx, ry := len(k.X)/2, len(k.Y)/2
+	c := newConvolution(src, opts, rx, ry, len(k.X)-1-rx, len(k.Y)-1-ry)
+	ch, w, h := c.ch, c.w, c.h
+
+	// The horizontal pass covers every row the vertical pass will read, including those beyond the edges (which is
+	// what the row map is for). The constant row (-1) is left out, as it's the same for every column: the constant
+	// times the sum of the horizontal weights.
+	rowsNeeded := len(c.rows)
+	tmp := make([]float32, rowsNeeded*w*ch)
+	var sumX float64
+	for _, wt := range k.X {
+		sumX += wt
+	}
+	constRow := make([]float32, ch)
+	for ci := range constRow {
+		constRow[ci] = float32(float64(c.constant[ci]) * sumX)
+	}
+	parallelRows(0, rowsNeeded, func(y0, y1 int) {
+		acc := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			row := c.rows[y]
+			if row < 0 {
+				continue
+			}
+			t := tmp[y*w*ch : (y+1)*w*ch]
+			for x := 0; x < w; x++ {
+				for i := range acc {
+					acc[i] = 0
+				}
+				for i, wt := range k.X {
+					p := c.pixel(c.cols[x+i], row)
+					for ci := 0; ci < ch; ci++ {
+						acc[ci] += wt * float64(p[ci])
+					}
+				}
+				for ci := 0; ci < ch; ci++ {
+					t[x*ch+ci] = float32(acc[ci])
+				}
+			}
+		}
+	})
+
+	parallelRows(0, h, func(y0, y1 int) {
+		acc := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				for i := range acc {
+					acc[i] = 0
+				}
+				for j, wt := range k.Y {
+					var p []float32
+					if c.rows[y+j] < 0 {
+						p = constRow
+					} else {
+						p = tmp[((y+j)*w+x)*ch : ((y+j)*w+x+1)*ch]
+					}
+					for ci := 0; ci < ch; ci++ {
+						acc[ci] += wt * float64(p[ci])
+					}
+				}
+				c.store(img, x, y, acc)
+			}
+		}
+	})
+}
+
+// convolution holds the state shared by the convolution passes: the source converted to (possibly premultiplied)
+// float values, and maps from kernel-offset coordinates to source coordinates implementing the edge mode.
+type convolution struct {
+	src  *Image
+	opts ConvolveOptions
+	w, h int
+	ch   int
+	// alpha is the index of the alpha channel, or -1 if there isn't one or it's being preserved.
+	alpha int
+	// premultiply is whether the values are premultiplied here (and must be un-premultiplied when storing).
+	premultiply bool
+	// maxValue is the maximum channel value.
+	maxValue float64
+	// vals holds the source channel values, ch per pixel, row-major with bounds starting at (0, 0).
+	vals []float32
+	// constant holds the channel values of the EdgeConstant color.
+	constant []float32
+	// cols[x+i] is the source column read by kernel column i for output column x, or -1 for the constant.
+	// rows is likewise for rows.
+	cols, rows []int
+}
+
+// newConvolution prepares src to be convolved with a kernel reaching left, up, right and down pixels beyond the
+// pixel being computed.
+func newConvolution(src *Image, opts ConvolveOptions, left, up, right, down int) *convolution {
+	c := &convolution{
+		src:      src,
+		opts:     opts,
+		w:        src.Rect.Dx(),
+		h:        src.Rect.Dy(),
+		ch:       src.channels(),
+		alpha:    src.alpha,
+		maxValue: src.maxValue(),
+	}
+	if opts.PreserveAlpha {
+		c.alpha = -1
+	}
+	c.premultiply = c.alpha >= 0 && !src.premul
+
+	c.vals = make([]float32, c.w*c.h*c.ch)
+	parallelRows(0, c.h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := src.offset(src.Rect.Min.X, src.Rect.Min.Y+y)
+			v := c.vals[y*c.w*c.ch : (y+1)*c.w*c.ch]
+			for x := 0; x < c.w; x++ {
+				c.load(v[x*c.ch:(x+1)*c.ch], src.Pix[o:o+src.bpp])
+				o += src.bpp
+			}
+		}
+	})
+	c.constant = make([]float32, c.ch)
+	if opts.Edge == EdgeConstant {
+		b := make([]uint8, src.bpp)
+		copy(b, opts.Constant)
+		c.load(c.constant, b)
+	}
+	// An empty image has no output pixels, and no pixels for the edge modes to map onto.
+	if c.w == 0 || c.h == 0 {
+		return c
+	}
+
+	c.cols = make([]int, c.w+left+right)
+	for i := range c.cols {
+		x, ok := edgeCoord(i-left, 0, c.w, opts.Edge)
+		if !ok {
+			x = -1
+		}
+		c.cols[i] = x
+	}
+	c.rows = make([]int, c.h+up+down)
+	for i := range c.rows {
+		y, ok := edgeCoord(i-up, 0, c.h, opts.Edge)
+		if !ok {
+			y = -1
+		}
+		c.rows[i] = y
+	}
+	return c
+}
+
+// load decodes the pixel p into v, premultiplying if needed.
+func (c *convolution) load(v []float32, p []uint8) {
+	d := c.src.depth
+	for ci := range v {
+		if d == 2 {
+			v[ci] = float32(uint16(p[ci*2])<<8 | uint16(p[ci*2+1]))
+		} else {
+			v[ci] = float32(p[ci])
+		}
+	}
+	if c.premultiply {
+		a := v[c.alpha] / float32(c.maxValue)
+		for ci := range v {
+			if ci != c.alpha {
+				v[ci] *= a
+			}
+		}
+	}
+}
+
+// pixel returns the values of the source pixel at (x, y), where either may be -1 for the constant.
+func (c *convolution) pixel(x, y int) []float32 {
+	if x < 0 || y < 0 {
+		return c.constant
+	}
+	o := (y*c.w + x) * c.ch
+	return c.vals[o : o+c.ch]
+}
+
+// store writes the convolution result acc (which it may modify) for (x, y), relative to the bounds' origin, to img.
+func (c *convolution) store(img *Image, x, y int, acc []float64) {
+	o := img.offset(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+	src := c.src
+	srcAlpha := -1.0
+	if src.alpha >= 0 {
+		srcAlpha = src.readChannel(src.offset(src.Rect.Min.X+x, src.Rect.Min.Y+y) + src.alpha*src.depth)
+	}
+
+	// The result's alpha, used to un-premultiply and (for premultiplied formats) cap the colors.
+	a := srcAlpha
+	if c.alpha >= 0 {
+		a = math.Max(0, math.Min(c.maxValue, acc[c.alpha]))
+	}
+	for ci := range acc {
+		if ci == src.alpha && c.alpha < 0 {
+			img.writeChannel(o+ci*img.depth, srcAlpha)
+			continue
+		}
+		v := acc[ci]
+		if c.premultiply && ci != c.alpha {
+			if a > 0 {
+				v = v * c.maxValue / a
+			} else {
+				v = 0
+			}
+		}
+		if c.opts.Abs {
+			v = math.Abs(v)
+		}
+		v += c.opts.Bias * c.maxValue
+		if src.premul && ci != src.alpha && a >= 0 && v > a {
+			v = a
+		}
+		img.writeChannel(o+ci*img.depth, v)
+	}
+}
+
+// BoxBlur returns a new Image holding src blurred by averaging the (2*radius+1)^2 pixel square around each pixel,
+// with clamped edges. For large radii, FastBoxBlur's cost doesn't grow with the radius.
+func BoxBlur(src *Image, radius int) (*Image, error) {
+	return ConvolveSeparable(src, BoxBlurKernel(radius), ConvolveOptions{})
+}
+
+// GaussianBlur returns a new Image holding src blurred with a Gaussian of standard deviation sigma (in pixels), with
+// clamped edges.
+func GaussianBlur(src *Image, sigma float64) (*Image, error) {
+	return ConvolveSeparable(src, GaussianKernel(sigma), ConvolveOptions{})
+}
+
+// Sharpen returns a new Image holding src sharpened with SharpenKernel(amount), with clamped edges.
+func Sharpen(src *Image, amount float64) (*Image, error) {
+	return Convolve(src, SharpenKernel(amount), ConvolveOptions{PreserveAlpha: true})
+}
+
+// Emboss returns a new Image holding src convolved with EmbossKernel, with clamped edges.
+func Emboss(src *Image) (*Image, error) {
+	return Convolve(src, EmbossKernel(), ConvolveOptions{PreserveAlpha: true})
+}
+
+// Laplacian returns a new Image holding the magnitude of src's Laplacian (see LaplacianKernel), per channel, with
+// clamped edges and alpha preserved.
+func Laplacian(src *Image, diagonals bool) (*Image, error) {
+	return Convolve(src, LaplacianKernel(diagonals), ConvolveOptions{PreserveAlpha: true, Abs: true})
+}
+
+// Sobel returns a new Image holding the Sobel gradient magnitude, sqrt(gx^2 + gy^2), of each channel of src, with
+// clamped edges and alpha preserved. Run it on a grayscale image for a conventional single-channel edge map.
+func Sobel(src *Image) (*Image, error) {
+	opts := ConvolveOptions{PreserveAlpha: true, Abs: true}
+	gx, err := Convolve(src, SobelXKernel(), opts)
+	if err != nil {
+		return nil, err
+	}
+	gy, err := Convolve(src, SobelYKernel(), opts)
+	if err != nil {
+		return nil, err
+	}
+	// Combine in place in gx. Since Abs was applied and the results were clamped, the magnitude is only exact up
+	// to the channel range, which is all it can be stored as anyway.
+	ch := gx.channels()
+	parallelRows(gx.Rect.Min.Y, gx.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := gx.offset(gx.Rect.Min.X, y)
+			for x := gx.Rect.Min.X; x < gx.Rect.Max.X; x++ {
+				for c := 0; c < ch; c++ {
+					if c == gx.alpha {
+						continue
+					}
+					co := o + c*gx.depth
+					a, b := gx.readChannel(co), gy.readChannel(co)
+					gx.writeChannel(co, math.Sqrt(a*a+b*b))
+				}
+				o += gx.bpp
+			}
+		}
+	})
+	return gx, nil
+}
+
+// UnsharpMask returns a new Image holding src sharpened by adding amount times the difference between src and a
+// Gaussian blur of it (with standard deviation sigma), wherever that difference exceeds threshold (as a fraction of
+// the channel range). Alpha is left untouched.
+func UnsharpMask(src *Image, sigma, amount, threshold float64) (*Image, error) {
+	blur, err := GaussianBlur(src, sigma)
+	if err != nil {
+		return nil, err
+	}
+	t := threshold * src.maxValue()
+	ch := src.channels()
+	parallelRows(src.Rect.Min.Y, src.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			so, bo := src.offset(src.Rect.Min.X, y), blur.offset(src.Rect.Min.X, y)
+			for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+				for c := 0; c < ch; c++ {
+					sc, bc := so+c*src.depth, bo+c*blur.depth
+					s := src.readChannel(sc)
+					if c != src.alpha {
+						if d := s - blur.readChannel(bc); math.Abs(d) > t {
+							s += amount * d
+						}
+					}
+					blur.writeChannel(bc, s)
+				}
+				so += src.bpp
+				bo += blur.bpp
+			}
+		}
+	})
+	return blur, nil
+}
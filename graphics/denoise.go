@@ -0,0 +1,281 @@
+package graphics
+
+import "math"
+
+// MedianFilter returns a new Image in which each channel of each pixel is the median of that channel over the
+// (2*radius+1)^2 pixel square around it. Near the edges, only the pixels within src are considered.
+// Median filtering removes salt-and-pepper noise while keeping edges sharp.
+// For 8-bit formats a sliding-window histogram is used (Huang's algorithm), so the cost per pixel grows only
+// linearly with radius; 16-bit formats fall back to selecting the median of each window, which is quadratic.
+// Rows are processed in parallel.
+func MedianFilter(src *Image, radius int) (*Image, error) {
+	dst, err := NewImageLike(src, src.Rect)
+	if err != nil {
+		return nil, err
+	}
+	if radius < 0 {
+		radius = 0
+	}
+	if src.depth == 1 {
+		parallelRows(src.Rect.Min.Y, src.Rect.Max.Y, func(y0, y1 int) {
+			medianRowsHistogram(dst, src, radius, y0, y1)
+		})
+	} else {
+		parallelRows(src.Rect.Min.Y, src.Rect.Max.Y, func(y0, y1 int) {
+			medianRowsSelect(dst, src, radius, y0, y1)
+		})
+	}
+	return dst, nil
+}
+
+// medianHistogram is a 256-bin histogram which tracks its median as values are added and removed.
+type medianHistogram struct {
+	bins [256]int
+	n    int
+	// med is the current median, and below the number of values < med. Keeping these up to date as the window
+	// slides means the median usually only moves a bin or two, rather than needing a scan from 0.
+	med, below int
+}
+
+func (h *medianHistogram) add(v uint8) {
+	h.bins[v]++
+	h.n++
+	if int(v) < h.med {
+		h.below++
+	}
+}
+
+func (h *medianHistogram) remove(v uint8) {
+	h.bins[v]--
+	h.n--
+	if int(v) < h.med {
+		h.below--
+	}
+}
+
+// median moves med to the lower median (the value with (n-1)/2 values below it and at least n/2 values at or below
+// it) and returns it.
+func (h *medianHistogram) median() uint8 {
+	rank := (h.n - 1) / 2
+	// Too many values below med: move down.
+	for h.below > rank {
+		h.med--
+		h.below -= h.bins[h.med]
+	}
+	// Not enough values at or below med: move up.
+	for h.below+h.bins[h.med] <= rank {
+		h.below += h.bins[h.med]
+		h.med++
+	}
+	return uint8(h.med)
+}
+
+// medianRowsHistogram computes rows [y0,y1) of the median filter of the 8-bit src into dst. Each row starts with a
+// fresh window histogram per channel, which then slides right one column at a time.
+func medianRowsHistogram(dst, src *Image, radius, y0, y1 int) {
+	r := src.Rect
+	ch := src.channels()
+	hists := make([]medianHistogram, ch)
+	// column adds (if add) or removes the in-bounds pixels of column x of the window around row y.
+	column := func(x, y int, add bool) {
+		if x < r.Min.X || x >= r.Max.X {
+			return
+		}
+		top, bottom := y-radius, y+radius+1
+		if top < r.Min.Y {
+			top = r.Min.Y
+		}
+		if bottom > r.Max.Y {
+			bottom = r.Max.Y
+		}
+		o := src.offset(x, top)
+		for yy := top; yy < bottom; yy++ {
+			for c := 0; c < ch; c++ {
+				if add {
+					hists[c].add(src.Pix[o+c])
+				} else {
+					hists[c].remove(src.Pix[o+c])
+				}
+			}
+			o += src.Stride
+		}
+	}
+
+	for y := y0; y < y1; y++ {
+		for c := range hists {
+			hists[c] = medianHistogram{}
+		}
+		for x := r.Min.X - radius; x < r.Min.X+radius; x++ {
+			column(x, y, true)
+		}
+		o := dst.offset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			column(x+radius, y, true)
+			for c := 0; c < ch; c++ {
+				dst.Pix[o+c] = hists[c].median()
+			}
+			column(x-radius, y, false)
+			o += dst.bpp
+		}
+	}
+}
+
+// medianRowsSelect computes rows [y0,y1) of the median filter of src into dst by gathering and partially sorting
+// each window. It works for any depth, but is only used for 16-bit formats.
+func medianRowsSelect(dst, src *Image, radius, y0, y1 int) {
+	r := src.Rect
+	ch := src.channels()
+	vals := make([]float64, 0, (2*radius+1)*(2*radius+1))
+	for y := y0; y < y1; y++ {
+		top, bottom := y-radius, y+radius+1
+		if top < r.Min.Y {
+			top = r.Min.Y
+		}
+		if bottom > r.Max.Y {
+			bottom = r.Max.Y
+		}
+		o := dst.offset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			left, right := x-radius, x+radius+1
+			if left < r.Min.X {
+				left = r.Min.X
+			}
+			if right > r.Max.X {
+				right = r.Max.X
+			}
+			for c := 0; c < ch; c++ {
+				vals = vals[:0]
+				for yy := top; yy < bottom; yy++ {
+					so := src.offset(left, yy) + c*src.depth
+					for xx := left; xx < right; xx++ {
+						vals = append(vals, src.readChannel(so))
+						so += src.bpp
+					}
+				}
+				dst.writeChannel(o+c*dst.depth, selectLowerMedian(vals))
+			}
+			o += dst.bpp
+		}
+	}
+}
+
+// selectLowerMedian returns the lower median of vals, reordering them in the process.
+func selectLowerMedian(vals []float64) float64 {
+	k := (len(vals) - 1) / 2
+	// Quickselect (Hoare partitioning around the middle element).
+	lo, hi := 0, len(vals)-1
+	for lo < hi {
+		pivot := vals[(lo+hi)/2]
+		i, j := lo, hi
+		for i <= j {
+			for vals[i] < pivot {
+				i++
+			}
+			for vals[j] > pivot {
+				j--
+			}
+			if i <= j {
+				vals[i], vals[j] = vals[j], vals[i]
+				i++
+				j--
+			}
+		}
+		if k <= j {
+			hi = j
+		} else if k >= i {
+			lo = i
+		} else {
+			break
+		}
+	}
+	return vals[k]
+}
+
+// BilateralFilter returns a new Image holding src smoothed with an edge-preserving bilateral filter: each pixel
+// becomes a weighted average of its neighbors, where the weight falls off with spatial distance (a Gaussian with
+// standard deviation sigmaSpace, in pixels) and with difference in color (a Gaussian with standard deviation
+// sigmaRange, as a fraction of the channel range; 0.1 is a reasonable start). So noise within a region is averaged
+// away, but pixels across a strong edge barely contribute and the edge stays sharp.
+// The color difference is the Euclidean distance over the color channels; the alpha channel is copied unchanged.
+// Neighbors are taken within 2*sigmaSpace pixels, and near the edges only those within src are considered. The
+// cost is quadratic in sigmaSpace. Rows are processed in parallel.
+func BilateralFilter(src *Image, sigmaSpace, sigmaRange float64) (*Image, error) {
+	dst, err := NewImageLike(src, src.Rect)
+	if err != nil {
+		return nil, err
+	}
+	if sigmaSpace <= 0 || sigmaRange <= 0 {
+		// src may be a sub-image, whose rows aren't contiguous like dst's.
+		n := src.Rect.Dx() * src.bpp
+		for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+			copy(dst.Pix[dst.offset(src.Rect.Min.X, y):][:n], src.Pix[src.offset(src.Rect.Min.X, y):])
+		}
+		return dst, nil
+	}
+
+	radius := int(math.Ceil(2 * sigmaSpace))
+	size := 2*radius + 1
+	spatial := make([]float64, size*size)
+	for j := 0; j < size; j++ {
+		for i := 0; i < size; i++ {
+			dx, dy := float64(i-radius), float64(j-radius)
+			spatial[j*size+i] = math.Exp(-(dx*dx + dy*dy) / (2 * sigmaSpace * sigmaSpace))
+		}
+	}
+	sr := sigmaRange * src.maxValue()
+	rangeCoef := -1 / (2 * sr * sr)
+
+	r := src.Rect
+	ch := src.channels()
+	parallelRows(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		center := make([]float64, ch)
+		acc := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			o := dst.offset(r.Min.X, y)
+			so := src.offset(r.Min.X, y)
+			for x := r.Min.X; x < r.Max.X; x++ {
+				for c := 0; c < ch; c++ {
+					center[c] = src.readChannel(so + c*src.depth)
+					acc[c] = 0
+				}
+				var total float64
+				for j := -radius; j <= radius; j++ {
+					yy := y + j
+					if yy < r.Min.Y || yy >= r.Max.Y {
+						continue
+					}
+					for i := -radius; i <= radius; i++ {
+						xx := x + i
+						if xx < r.Min.X || xx >= r.Max.X {
+							continue
+						}
+						no := src.offset(xx, yy)
+						var d2 float64
+						for c := 0; c < ch; c++ {
+							if c == src.alpha {
+								continue
+							}
+							d := src.readChannel(no+c*src.depth) - center[c]
+							d2 += d * d
+						}
+						wt := spatial[(j+radius)*size+i+radius] * math.Exp(d2*rangeCoef)
+						total += wt
+						for c := 0; c < ch; c++ {
+							acc[c] += wt * src.readChannel(no+c*src.depth)
+						}
+					}
+				}
+				for c := 0; c < ch; c++ {
+					if c == src.alpha {
+						dst.writeChannel(o+c*dst.depth, center[c])
+					} else {
+						dst.writeChannel(o+c*dst.depth, acc[c]/total)
+					}
+				}
+				o += dst.bpp
+				so += src.bpp
+			}
+		}
+	})
+	return dst, nil
+}
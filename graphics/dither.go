@@ -0,0 +1,366 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// DitherMethod selects the algorithm Dither uses.
+type DitherMethod int
+
+const (
+	// DitherNone maps each pixel to its nearest palette entry, as Quantize does.
+	DitherNone DitherMethod = iota
+	// DitherFloydSteinberg diffuses each pixel's error to 4 neighbors.
+	DitherFloydSteinberg
+	// DitherAtkinson diffuses 3/4 of each pixel's error to 6 neighbors. Discarding the rest gives higher contrast,
+	// with some loss of detail in highlights and shadows; it suits small, 1-bit output.
+	DitherAtkinson
+	// DitherJarvisJudiceNinke diffuses each pixel's error to 12 neighbors over two rows, which is smoother than
+	// Floyd-Steinberg but slower.
+	DitherJarvisJudiceNinke
+	// DitherBayer2, DitherBayer4 and DitherBayer8 are ordered dithering with Bayer matrices of the given size. Larger
+	// matrices give more apparent levels; the regular cross-hatch pattern is well suited to printers.
+	DitherBayer2
+	DitherBayer4
+	DitherBayer8
+	// DitherBlueNoise is ordered dithering with a 64x64 blue-noise matrix, which avoids the visible patterns of both
+	// Bayer matrices and error diffusion.
+	DitherBlueNoise
+)
+
+// diffusionTap is an entry of an error diffusion kernel: the error share w/div goes to the pixel dx along the scan
+// direction and dy rows below.
+type diffusionTap struct {
+	dx, dy int
+	w      float32
+}
+
+// diffusionKernels holds the kernels of the error diffusion methods, and their divisors.
+var diffusionKernels = map[DitherMethod]struct {
+	taps []diffusionTap
+	div  float32
+}{
+	DitherFloydSteinberg: {[]diffusionTap{{1, 0, 7}, {-1, 1, 3}, {0, 1, 5}, {1, 1, 1}}, 16},
+	DitherAtkinson:       {[]diffusionTap{{1, 0, 1}, {2, 0, 1}, {-1, 1, 1}, {0, 1, 1}, {1, 1, 1}, {0, 2, 1}}, 8},
+	DitherJarvisJudiceNinke: {[]diffusionTap{
+		{1, 0, 7}, {2, 0, 5},
+		{-2, 1, 3}, {-1, 1, 5}, {0, 1, 7}, {1, 1, 5}, {2, 1, 3},
+		{-2, 2, 1}, {-1, 2, 3}, {0, 2, 5}, {1, 2, 3}, {2, 2, 1},
+	}, 48},
+}
+
+// GrayPalette returns a palette of n evenly spaced grays from black to white (n >= 2), such as for 1-bit (n = 2) or
+// 4-gray (n = 4) displays.
+func GrayPalette(n int) color.Palette {
+	if n < 2 {
+		n = 2
+	}
+	p := make(color.Palette, n)
+	for i := range p {
+		p[i] = color.Gray{Y: uint8((i*255 + (n-1)/2) / (n - 1))}
+	}
+	return p
+}
+
+// Dither returns an image.Paletted, with img's bounds and palette p, approximating img with method. Colors are
+// compared in straight (non-premultiplied) 8-bit RGBA, and only R, G and B are dithered; alpha just picks the
+// nearest entry. p can have at most 256 colors, as image.Paletted has a byte per pixel.
+// Error diffusion scans in alternating directions (serpentine order), which avoids the diagonal artifacts of always
+// scanning left to right. It is inherently sequential, while ordered dithering processes rows in parallel.
+func Dither(img *Image, p color.Palette, method DitherMethod) (*image.Paletted, error) {
+	if err := checkPaletteSize(p); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return image.NewPaletted(img.Rect, p), nil
+	}
+	switch method {
+	case DitherFloydSteinberg, DitherAtkinson, DitherJarvisJudiceNinke:
+		return diffuseDither(img, p, method), nil
+	case DitherBayer2:
+		return orderedDither(img, p, bayerMatrix(2), 2), nil
+	case DitherBayer4:
+		return orderedDither(img, p, bayerMatrix(4), 4), nil
+	case DitherBayer8:
+		return orderedDither(img, p, bayerMatrix(8), 8), nil
+	case DitherBlueNoise:
+		return orderedDither(img, p, blueNoiseMatrix(), blueNoiseSize), nil
+	}
+	return Quantize(img, p)
+}
+
+// paletteMatcher finds nearest palette entries, remembering its answers since images usually have far fewer
+// distinct colors than pixels. The palette must have at most 256 entries. It is not safe for concurrent use.
+type paletteMatcher struct {
+	pal   [][4]uint8
+	cache map[[4]uint8]uint8
+}
+
+func newPaletteMatcher(pal [][4]uint8) *paletteMatcher {
+	return &paletteMatcher{pal: pal, cache: make(map[[4]uint8]uint8)}
+}
+
+// nearest returns the index of the entry nearest to c.
+func (m *paletteMatcher) nearest(c [4]uint8) uint8 {
+	i, ok := m.cache[c]
+	if !ok {
+		i = uint8(nearestNRGBA(m.pal, c))
+		m.cache[c] = i
+	}
+	return i
+}
+
+// clampByte rounds v and clamps it to [0,255].
+func clampByte(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func diffuseDither(img *Image, p color.Palette, method DitherMethod) *image.Paletted {
+	dst := image.NewPaletted(img.Rect, p)
+	pal := nrgbaPalette(p)
+	m := newPaletteMatcher(pal)
+	k := diffusionKernels[method]
+	w := img.Rect.Dx()
+	// errs[dy] holds the error accumulated for the row dy below the current one, in RGB.
+	var errs [3][][3]float32
+	for i := range errs {
+		errs[i] = make([][3]float32, w)
+	}
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		dir, x0 := 1, 0
+		if (y-img.Rect.Min.Y)%2 == 1 {
+			dir, x0 = -1, w-1
+		}
+		for i, x := 0, x0; i < w; i, x = i+1, x+dir {
+			ax := img.Rect.Min.X + x
+			c := img.nrgbaAt(img.offset(ax, y), ax, y)
+			q := [4]uint8{c.R, c.G, c.B, c.A}
+			if c.A == 0 {
+				// Fully transparent pixels have no color to be wrong about.
+				dst.Pix[dst.PixOffset(ax, y)] = m.nearest(q)
+				continue
+			}
+			var v [3]float32
+			for ch := range v {
+				v[ch] = float32(q[ch]) + errs[0][x][ch]
+				q[ch] = clampByte(v[ch])
+			}
+			idx := m.nearest(q)
+			dst.Pix[dst.PixOffset(ax, y)] = idx
+			var e [3]float32
+			for ch := range e {
+				// Diffusing the clamped value's error keeps accumulated error from running away.
+				e[ch] = (float32(math.Max(0, math.Min(255, float64(v[ch])))) - float32(pal[idx][ch])) / k.div
+			}
+			for _, t := range k.taps {
+				if xx := x + t.dx*dir; xx >= 0 && xx < w {
+					for ch := range e {
+						errs[t.dy][xx][ch] += e[ch] * t.w
+					}
+				}
+			}
+		}
+		errs[0], errs[1], errs[2] = errs[1], errs[2], errs[0]
+		for i := range errs[2] {
+			errs[2][i] = [3]float32{}
+		}
+	}
+	return dst
+}
+
+// orderedDither dithers img with the n x n threshold matrix m, whose entries are in [0,1), tiled from the origin.
+func orderedDither(img *Image, p color.Palette, m []float32, n int) *image.Paletted {
+	dst := image.NewPaletted(img.Rect, p)
+	pal := nrgbaPalette(p)
+	spread := paletteSpread(pal)
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		pm := newPaletteMatcher(pal)
+		for y := y0; y < y1; y++ {
+			row := m[((y%n+n)%n)*n:]
+			o := img.offset(img.Rect.Min.X, y)
+			do := dst.PixOffset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o, do = x+1, o+img.bpp, do+1 {
+				c := img.nrgbaAt(o, x, y)
+				q := [4]uint8{c.R, c.G, c.B, c.A}
+				if c.A != 0 {
+					d := spread * (row[(x%n+n)%n] - 0.5)
+					for ch := 0; ch < 3; ch++ {
+						q[ch] = clampByte(float32(q[ch]) + d)
+					}
+				}
+				dst.Pix[do] = pm.nearest(q)
+			}
+		}
+	})
+	return dst
+}
+
+// paletteSpread estimates the typical per-channel step between the colors of pal, which is how far ordered dithering
+// needs to push colors for them to reach neighboring entries: the mean distance from each entry to its nearest other
+// entry in RGB, scaled to a single channel. For n evenly spaced grays it is exactly the step, 255/(n-1).
+func paletteSpread(pal [][4]uint8) float32 {
+	if len(pal) < 2 {
+		return 0
+	}
+	var total float64
+	for i, a := range pal {
+		best := -1
+		for j, b := range pal {
+			if i == j {
+				continue
+			}
+			d := 0
+			for ch := 0; ch < 3; ch++ {
+				v := int(a[ch]) - int(b[ch])
+				d += v * v
+			}
+			if best < 0 || d < best {
+				best = d
+			}
+		}
+		total += math.Sqrt(float64(best) / 3)
+	}
+	return float32(total / float64(len(pal)))
+}
+
+// bayerMatrix returns the n x n Bayer threshold matrix (n a power of 2), with entries (i+0.5)/n² for i in [0,n²).
+func bayerMatrix(n int) []float32 {
+	// Build the index matrix recursively: M(2k) = [4M(k) 4M(k)+2; 4M(k)+3 4M(k)+1].
+	idx := []int{0}
+	for k := 1; k < n; k *= 2 {
+		next := make([]int, 4*k*k)
+		for y := 0; y < k; y++ {
+			for x := 0; x < k; x++ {
+				v := 4 * idx[y*k+x]
+				next[y*2*k+x] = v
+				next[y*2*k+x+k] = v + 2
+				next[(y+k)*2*k+x] = v + 3
+				next[(y+k)*2*k+x+k] = v + 1
+			}
+		}
+		idx = next
+	}
+	m := make([]float32, n*n)
+	for i, v := range idx {
+		m[i] = (float32(v) + 0.5) / float32(n*n)
+	}
+	return m
+}
+
+// blueNoiseSize is the width and height of the blue-noise matrix.
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoise     []float32
+)
+
+// blueNoiseMatrix returns the blueNoiseSize x blueNoiseSize blue-noise threshold matrix, generating it on first use.
+func blueNoiseMatrix() []float32 {
+	blueNoiseOnce.Do(func() { blueNoise = voidAndCluster(blueNoiseSize, 1.5) })
+	return blueNoise
+}
+
+// voidAndCluster generates an n x n blue-noise threshold matrix with Ulichney's void-and-cluster method, using a
+// Gaussian of the given sigma (wrapping around the edges, so the matrix tiles seamlessly) to measure how clustered
+// each pixel is. It is deterministic.
+func voidAndCluster(n int, sigma float64) []float32 {
+	size := n * n
+	// weight[dy*n+dx] is the Gaussian weight of an offset of (dx, dy), taking the shorter way around each axis.
+	weight := make([]float64, size)
+	for dy := 0; dy < n; dy++ {
+		for dx := 0; dx < n; dx++ {
+			wx, wy := math.Min(float64(dx), float64(n-dx)), math.Min(float64(dy), float64(n-dy))
+			weight[dy*n+dx] = math.Exp(-(wx*wx + wy*wy) / (2 * sigma * sigma))
+		}
+	}
+	// energy[i] is the sum of the weights from every set pixel to pixel i.
+	energy := make([]float64, size)
+	set := make([]bool, size)
+	toggle := func(i int, on bool) {
+		set[i] = on
+		s := 1.0
+		if !on {
+			s = -1
+		}
+		ix, iy := i%n, i/n
+		for y := 0; y < n; y++ {
+			dy := (y - iy + n) % n
+			for x := 0; x < n; x++ {
+				energy[y*n+x] += s * weight[dy*n+(x-ix+n)%n]
+			}
+		}
+	}
+	// tightest returns the set pixel with the most energy (the center of the tightest cluster); largest returns the
+	// unset pixel with the least (the center of the largest void).
+	tightest := func() int {
+		best := -1
+		for i, on := range set {
+			if on && (best < 0 || energy[i] > energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	largest := func() int {
+		best := -1
+		for i, on := range set {
+			if !on && (best < 0 || energy[i] < energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// Start from a random tenth of the pixels, and even them out by moving the tightest cluster into the largest
+	// void until that would put it straight back.
+	r := rand.New(rand.NewSource(1))
+	ones := size / 10
+	for _, i := range r.Perm(size)[:ones] {
+		toggle(i, true)
+	}
+	for {
+		c := tightest()
+		toggle(c, false)
+		v := largest()
+		if v == c {
+			toggle(c, true)
+			break
+		}
+		toggle(v, true)
+	}
+	initial := append([]bool(nil), set...)
+	initialEnergy := append([]float64(nil), energy...)
+
+	rank := make([]int, size)
+	// Rank the initial pixels by repeatedly removing the tightest cluster...
+	for k := ones - 1; k >= 0; k-- {
+		i := tightest()
+		toggle(i, false)
+		rank[i] = k
+	}
+	// ...and the rest by repeatedly filling the largest void.
+	copy(set, initial)
+	copy(energy, initialEnergy)
+	for k := ones; k < size; k++ {
+		i := largest()
+		toggle(i, true)
+		rank[i] = k
+	}
+
+	m := make([]float32, size)
+	for i, k := range rank {
+		m[i] = (float32(k) + 0.5) / float32(size)
+	}
+	return m
+}
@@ -0,0 +1,150 @@
+package graphics
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	ccslmath "github.com/HaileyStorm/CCSL_go/math"
+	"github.com/nfnt/resize"
+)
+
+// dominantSampleSize is the largest width and height DominantColors works at; larger images are downsampled first.
+const dominantSampleSize = 128
+
+// DominantColor is a color found by DominantColors, and the fraction of the image's (opaque) pixels it represents.
+type DominantColor struct {
+	Color    color.NRGBA
+	Fraction float64
+}
+
+// DominantColors returns up to n colors which best represent img, most dominant first, with the fraction of img each
+// accounts for (the fractions sum to 1).
+// img is first downsampled (with bilinear interpolation) to fit within 128x128, and its colors are then clustered with
+// k-means in CIE L*a*b* space, where distances match perceived differences better than in RGB. Pixels count in
+// proportion to their alpha, and fully transparent ones are ignored. The clustering is seeded from seed (via the math
+// package's NewRandom), so the result is deterministic for a given seed. Fewer than n colors are returned if img has
+// fewer distinct colors, and none if it is empty or fully transparent.
+func DominantColors(img *Image, n int, seed int64) []DominantColor {
+	if n < 1 || img.Rect.Empty() {
+		return nil
+	}
+	sample := img
+	if img.Rect.Dx() > dominantSampleSize || img.Rect.Dy() > dominantSampleSize {
+		sample = imageFor(resize.Thumbnail(dominantSampleSize, dominantSampleSize, img.Imager, resize.Bilinear))
+	}
+
+	type point struct {
+		lab [3]float64
+		w   float64
+	}
+	var points []point
+	var total float64
+	for _, c := range colorCounts(sample) {
+		if c.c[3] == 0 {
+			continue
+		}
+		var p point
+		p.lab[0], p.lab[1], p.lab[2] = RGBToLab(float64(c.c[0])/255, float64(c.c[1])/255, float64(c.c[2])/255)
+		p.w = float64(c.n) * float64(c.c[3]) / 255
+		points = append(points, p)
+		total += p.w
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	if n > len(points) {
+		n = len(points)
+	}
+
+	dist := func(a, b [3]float64) float64 {
+		d0, d1, d2 := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+		return d0*d0 + d1*d1 + d2*d2
+	}
+	// pick returns the index of a point chosen at random in proportion to weight(i).
+	r := ccslmath.NewRandom(seed)
+	pick := func(weight func(i int) float64) int {
+		var sum float64
+		for i := range points {
+			sum += weight(i)
+		}
+		t := r.Float64() * sum
+		for i := range points {
+			if t -= weight(i); t < 0 {
+				return i
+			}
+		}
+		return len(points) - 1
+	}
+
+	// Choose the initial centers with k-means++: each is picked in proportion to its weight times its squared
+	// distance from the nearest center so far, which spreads them out.
+	centers := [][3]float64{points[pick(func(i int) float64 { return points[i].w })].lab}
+	nearest := make([]float64, len(points))
+	for i, p := range points {
+		nearest[i] = dist(p.lab, centers[0])
+	}
+	for len(centers) < n {
+		c := points[pick(func(i int) float64 { return points[i].w * nearest[i] })].lab
+		centers = append(centers, c)
+		for i, p := range points {
+			nearest[i] = math.Min(nearest[i], dist(p.lab, c))
+		}
+	}
+
+	// Then refine them with Lloyd's algorithm until the assignments settle.
+	assign := make([]int, len(points))
+	weights := make([]float64, n)
+	for it := 0; it < 100; it++ {
+		changed := it == 0
+		for i, p := range points {
+			best := 0
+			for k := 1; k < n; k++ {
+				if dist(p.lab, centers[k]) < dist(p.lab, centers[best]) {
+					best = k
+				}
+			}
+			if assign[i] != best {
+				assign[i], changed = best, true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([][3]float64, n)
+		for k := range weights {
+			weights[k] = 0
+		}
+		for i, p := range points {
+			k := assign[i]
+			for j := range sums[k] {
+				sums[k][j] += p.lab[j] * p.w
+			}
+			weights[k] += p.w
+		}
+		for k := range centers {
+			if weights[k] > 0 {
+				for j := range centers[k] {
+					centers[k][j] = sums[k][j] / weights[k]
+				}
+			}
+		}
+	}
+
+	out := make([]DominantColor, 0, n)
+	for k, c := range centers {
+		if weights[k] == 0 {
+			continue
+		}
+		rr, g, b := LabToRGB(c[0], c[1], c[2])
+		out = append(out, DominantColor{
+			Color: color.NRGBA{
+				R: uint8(math.Round(clamp01(rr) * 255)), G: uint8(math.Round(clamp01(g) * 255)),
+				B: uint8(math.Round(clamp01(b) * 255)), A: 255,
+			},
+			Fraction: weights[k] / total,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Fraction > out[j].Fraction })
+	return out
+}
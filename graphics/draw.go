@@ -45,6 +45,18 @@ func (img *Image) DrawCircleBorder(cx, cy, rad int, pixelBytes ...uint8) {
 // License(s):
 // https://creativecommons.org/licenses/by-sa/3.0/
 func (img *Image) DrawFilledCircle(cx, cy, rad int, pixelBytes ...uint8) {
+	img.filledCircle(cx, cy, rad, func(x0, y, x1 int) { img.DrawHLine(x0, y, x1, pixelBytes...) })
+}
+
+// DrawFilledCircleWithPaint draws a filled-in (rasterized) circle, centered on (cx, cy), like DrawFilledCircle, but
+// with its colors supplied by p. Colors which aren't fully opaque are blended over the existing pixels.
+func (img *Image) DrawFilledCircleWithPaint(cx, cy, rad int, p Paint) {
+	img.filledCircle(cx, cy, rad, func(x0, y, x1 int) { img.paintHLine(x0, y, x1, p) })
+}
+
+// filledCircle calls hline with the (inclusive) extent of each row of a filled circle centered on (cx, cy). Each row
+// is passed exactly once. See DrawFilledCircle for attribution.
+func (img *Image) filledCircle(cx, cy, rad int, hline func(x0, y, x1 int)) {
 	// If circle falls entirely outside the environment, return
 	if (cx+rad < 0 || cx-rad > img.Bounds().Dx()) && (cy+rad < 0 || cy-rad > img.Bounds().Dy()) {
 		return
@@ -59,11 +71,11 @@ func (img *Image) DrawFilledCircle(cx, cy, rad int, pixelBytes ...uint8) {
 		y++
 		err += y
 
-		img.drawTwoCenteredLines(cx, cy, x, lastY, pixelBytes...)
+		drawTwoCenteredLines(cx, cy, x, lastY, hline)
 
 		if err >= 0 {
 			if x != lastY {
-				img.drawTwoCenteredLines(cx, cy, lastY, x, pixelBytes...)
+				drawTwoCenteredLines(cx, cy, lastY, x, hline)
 			}
 
 			err -= x
@@ -73,15 +85,13 @@ func (img *Image) DrawFilledCircle(cx, cy, rad int, pixelBytes ...uint8) {
 	}
 }
 
-// drawTwoCenteredLines draws two lines of length 2*dx+1, centered on (cx,cy) and of the color provided by pixelBytes,
-// and with a gap of 2*dx-1 rows/pixels between them (that is, the line at cy and dy-1 lines to either side of it are
-// not drawn).
-// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+// drawTwoCenteredLines draws two lines of length 2*dx+1 with hline, centered on (cx,cy), and with a gap of 2*dx-1
+// rows/pixels between them (that is, the line at cy and dy-1 lines to either side of it are not drawn).
 // This is used by DrawFilledCircle. See attribution there.
-func (img *Image) drawTwoCenteredLines(cx, cy, dx, dy int, pixelBytes ...uint8) {
-	img.DrawHLine(cx-dx, cy+dy, cx+dx, pixelBytes...)
+func drawTwoCenteredLines(cx, cy, dx, dy int, hline func(x0, y, x1 int)) {
+	hline(cx-dx, cy+dy, cx+dx)
 	if dy != 0 {
-		img.DrawHLine(cx-dx, cy-dy, cx+dx, pixelBytes...)
+		hline(cx-dx, cy-dy, cx+dx)
 	}
 }
 
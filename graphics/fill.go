@@ -0,0 +1,184 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// FillRule selects which points are inside a shape whose outline crosses itself or has several parts.
+type FillRule int
+
+const (
+	// FillNonZero counts a point as inside if the outline winds around it a non-zero number of times (counting
+	// clockwise and counter-clockwise windings oppositely), so overlapping parts are filled, unless wound in opposite
+	// directions.
+	FillNonZero FillRule = iota
+	// FillEvenOdd counts a point as inside if a ray from it crosses the outline an odd number of times, so overlapping
+	// parts alternate between filled and empty.
+	FillEvenOdd
+)
+
+// DrawFilledRect draws a filled-in rectangle covering r (pixel coordinates, so r.Max is excluded), of the color
+// provided by pixelBytes.
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) DrawFilledRect(r image.Rectangle, pixelBytes ...uint8) {
+	if len(pixelBytes) > img.bpp {
+		return
+	}
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		o := img.offset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x, o = x+1, o+img.bpp {
+			copy(img.Pix[o:o+len(pixelBytes)], pixelBytes)
+		}
+	}
+}
+
+// DrawFilledRectWithPaint draws a filled-in rectangle covering r, like DrawFilledRect, but with its colors supplied by
+// p. Colors which aren't fully opaque are blended over the existing pixels.
+func (img *Image) DrawFilledRectWithPaint(r image.Rectangle, p Paint) {
+	r = r.Intersect(img.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		img.paintHLine(r.Min.X, y, r.Max.X-1, p)
+	}
+}
+
+// DrawFilledPolygon draws a filled-in polygon with vertices pts (which is implicitly closed), of the color provided by
+// pixelBytes. Pixels are filled if their centers are inside the polygon under rule; there is no anti-aliasing.
+// Coordinates are in pixels, so the polygon (0,0), (2,0), (2,2), (0,2) exactly covers the pixels (0,0) to (1,1).
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) DrawFilledPolygon(pts []Vec2, rule FillRule, pixelBytes ...uint8) {
+	fillPolygons([][]Vec2{pts}, rule, img.Rect, func(x0, y, x1 int) { img.DrawHLine(x0, y, x1, pixelBytes...) })
+}
+
+// DrawFilledPolygonWithPaint draws a filled-in polygon with vertices pts, like DrawFilledPolygon, but with its colors
+// supplied by p. Colors which aren't fully opaque are blended over the existing pixels.
+func (img *Image) DrawFilledPolygonWithPaint(pts []Vec2, rule FillRule, p Paint) {
+	fillPolygons([][]Vec2{pts}, rule, img.Rect, func(x0, y, x1 int) { img.paintHLine(x0, y, x1, p) })
+}
+
+// polygonEdge is a non-horizontal edge of a polygon, oriented downward, with dir recording whether it originally
+// went down (1) or up (-1).
+type polygonEdge struct {
+	x0, y0, x1, y1 float64
+	dir            int
+}
+
+// fillPolygons calls hline with the (inclusive) extent of each run of pixels within clip whose centers are inside the
+// shape made up of polys (each implicitly closed) under rule.
+func fillPolygons(polys [][]Vec2, rule FillRule, clip image.Rectangle, hline func(x0, y, x1 int)) {
+	var edges []polygonEdge
+	for _, pts := range polys {
+		for i, a := range pts {
+			b := pts[(i+1)%len(pts)]
+			switch {
+			case a.Y < b.Y:
+				edges = append(edges, polygonEdge{a.X, a.Y, b.X, b.Y, 1})
+			case a.Y > b.Y:
+				edges = append(edges, polygonEdge{b.X, b.Y, a.X, a.Y, -1})
+			}
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	ymin, ymax := edges[0].y0, edges[0].y1
+	for _, e := range edges {
+		ymax = math.Max(ymax, e.y1)
+	}
+	// Rows whose centers (y+0.5) are within [ymin, ymax).
+	y0 := int(math.Max(float64(clip.Min.Y), math.Ceil(ymin-0.5)))
+	y1 := int(math.Min(float64(clip.Max.Y), math.Ceil(ymax-0.5)))
+
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	var active []polygonEdge
+	var xs []crossing
+	next := 0
+	for y := y0; y < y1; y++ {
+		sy := float64(y) + 0.5
+		for next < len(edges) && edges[next].y0 <= sy {
+			active = append(active, edges[next])
+			next++
+		}
+		// Drop finished edges, and find where the rest cross the row's center line.
+		xs = xs[:0]
+		n := 0
+		for _, e := range active {
+			if e.y1 <= sy {
+				continue
+			}
+			active[n] = e
+			n++
+			xs = append(xs, crossing{e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.dir})
+		}
+		active = active[:n]
+		sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+
+		winding := 0
+		for i := 0; i+1 < len(xs); i++ {
+			winding += xs[i].dir
+			inside := winding != 0
+			if rule == FillEvenOdd {
+				inside = (i+1)%2 == 1
+			}
+			if !inside {
+				continue
+			}
+			// Pixels whose centers (x+0.5) are within [xs[i], xs[i+1]).
+			x0 := int(math.Max(float64(clip.Min.X), math.Ceil(xs[i].x-0.5)))
+			x1 := int(math.Min(float64(clip.Max.X), math.Ceil(xs[i+1].x-0.5))) - 1
+			if x0 <= x1 {
+				hline(x0, y, x1)
+			}
+		}
+	}
+}
+
+// paintHLine draws a horizontal line from (x0,y) to (x1,y), clipped to img, with its colors supplied by p.
+func (img *Image) paintHLine(x0, y, x1 int, p Paint) {
+	if y < img.Rect.Min.Y || y >= img.Rect.Max.Y {
+		return
+	}
+	if x0 < img.Rect.Min.X {
+		x0 = img.Rect.Min.X
+	}
+	if x1 >= img.Rect.Max.X {
+		x1 = img.Rect.Max.X - 1
+	}
+	for x, o := x0, img.offset(x0, y); x <= x1; x, o = x+1, o+img.bpp {
+		img.paintPixel(o, x, y, p.ColorAt(x, y))
+	}
+}
+
+// paintPixel blends c over the pixel at offset o (and coordinates (x, y)). RGB formats are written directly; others
+// go through Set.
+func (img *Image) paintPixel(o, x, y int, c color.NRGBA64) {
+	if c.A == 0 {
+		return
+	}
+	out := [4]float64{float64(c.R) / 65535, float64(c.G) / 65535, float64(c.B) / 65535, float64(c.A) / 65535}
+	if c.A != 0xffff {
+		cb := img.straightAt(o, x, y)
+		as, ab := out[3], cb[3]
+		ao := as + ab*(1-as)
+		for ch := 0; ch < 3; ch++ {
+			out[ch] = (out[ch]*as + cb[ch]*ab*(1-as)) / ao
+		}
+		out[3] = ao
+	}
+	if img.isRGB() {
+		img.setStraight(o, out)
+		return
+	}
+	img.Set(x, y, color.NRGBA64{
+		R: uint16(out[0]*65535 + 0.5), G: uint16(out[1]*65535 + 0.5),
+		B: uint16(out[2]*65535 + 0.5), A: uint16(out[3]*65535 + 0.5),
+	})
+}
@@ -0,0 +1,328 @@
+package graphics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// LoadBitmapFont loads a BDF or PSF (version 1 or 2, optionally gzipped, as console fonts usually are) font from the
+// file at path, detecting the format from its contents. See ParseBDF and ParsePSF.
+func LoadBitmapFont(path string) (*BitmapFont, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("STARTFONT")) {
+		return ParseBDF(bytes.NewReader(data))
+	}
+	return ParsePSF(bytes.NewReader(data))
+}
+
+// LoadBDF loads a BDF font from the file at path. See ParseBDF.
+func LoadBDF(path string) (*BitmapFont, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseBDF(file)
+}
+
+// ParseBDF parses a font in the X11 Glyph Bitmap Distribution Format. Glyphs are keyed by their ENCODING, which is
+// taken to be a Unicode code point (as it is for ISO10646 and ISO8859-1 fonts); unencoded glyphs are skipped. The
+// fallback is the DEFAULT_CHAR glyph if the font names one, and otherwise U+FFFD or '?' if it has them. FONT_ASCENT
+// and FONT_DESCENT give the line metrics, defaulting to those of the FONTBOUNDINGBOX. Bounding boxes of negative size,
+// or more than 4096 pixels across, are an error.
+func ParseBDF(r io.Reader) (*BitmapFont, error) {
+	f := &BitmapFont{Glyphs: make(map[rune]*Glyph)}
+	sc := bufio.NewScanner(r)
+	line := 0
+	// next returns the fields of the next non-empty line.
+	next := func() ([]string, bool) {
+		for sc.Scan() {
+			line++
+			if fields := strings.Fields(sc.Text()); len(fields) > 0 {
+				return fields, true
+			}
+		}
+		return nil, false
+	}
+	ints := func(fields []string, n int) ([]int, error) {
+		if len(fields) < n {
+			return nil, fmt.Errorf("line %d: %s needs %d values", line, fields[0], n-1)
+		}
+		v := make([]int, n-1)
+		for i := range v {
+			var err error
+			if v[i], err = strconv.Atoi(fields[i+1]); err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", line, fields[0], err)
+			}
+		}
+		return v, nil
+	}
+
+	ascent, descent, defaultChar := -1, -1, -1
+	var bbox []int
+	var fontAdvance int
+	var g *Glyph
+	var enc int
+	for {
+		fields, ok := next()
+		if !ok {
+			break
+		}
+		var err error
+		var v []int
+		switch fields[0] {
+		case "FONT":
+			f.Name = strings.Join(fields[1:], " ")
+		case "FONTBOUNDINGBOX":
+			if bbox, err = ints(fields, 5); err == nil {
+				err = checkBBX(bbox, line)
+			}
+		case "FONT_ASCENT", "FONT_DESCENT", "DEFAULT_CHAR":
+			if v, err = ints(fields, 2); err == nil {
+				switch fields[0] {
+				case "FONT_ASCENT":
+					ascent = v[0]
+				case "FONT_DESCENT":
+					descent = v[0]
+				default:
+					defaultChar = v[0]
+				}
+			}
+		case "STARTCHAR":
+			g, enc = &Glyph{Advance: fontAdvance}, -1
+			if bbox != nil {
+				g.Width, g.Height, g.XOffset, g.YOffset = bbox[0], bbox[1], bbox[2], -(bbox[1] + bbox[3])
+			}
+		case "ENCODING":
+			if v, err = ints(fields, 2); err == nil {
+				enc = v[0]
+			}
+		case "DWIDTH":
+			if v, err = ints(fields, 3); err == nil {
+				if g != nil {
+					g.Advance = v[0]
+				} else {
+					fontAdvance = v[0]
+				}
+			}
+		case "BBX":
+			if v, err = ints(fields, 5); err == nil {
+				err = checkBBX(v, line)
+			}
+			if err == nil && g != nil {
+				g.Width, g.Height, g.XOffset, g.YOffset = v[0], v[1], v[2], -(v[1] + v[3])
+			}
+		case "BITMAP":
+			if g == nil {
+				return nil, fmt.Errorf("line %d: BITMAP outside a glyph", line)
+			}
+			stride := (g.Width + 7) / 8
+			g.Bits = make([]uint8, stride*g.Height)
+			for y := 0; y < g.Height; y++ {
+				row, ok := next()
+				if !ok {
+					return nil, fmt.Errorf("line %d: bitmap ended early", line)
+				}
+				b, err := hex.DecodeString(row[0])
+				if err != nil || len(b) < stride {
+					return nil, fmt.Errorf("line %d: invalid bitmap row %q", line, row[0])
+				}
+				copy(g.Bits[y*stride:], b[:stride])
+			}
+		case "ENDCHAR":
+			if g != nil && enc >= 0 {
+				if g.Bits == nil {
+					g.Bits = make([]uint8, (g.Width+7)/8*g.Height)
+				}
+				f.Glyphs[rune(enc)] = g
+			}
+			g = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(f.Glyphs) == 0 {
+		return nil, errors.New("no glyphs")
+	}
+
+	if ascent < 0 && bbox != nil {
+		ascent = bbox[1] + bbox[3]
+	}
+	if descent < 0 && bbox != nil {
+		descent = -bbox[3]
+	}
+	if ascent < 0 || descent < 0 {
+		return nil, errors.New("no FONT_ASCENT, FONT_DESCENT or FONTBOUNDINGBOX")
+	}
+	f.Ascent, f.Descent = ascent, descent
+	if g, ok := f.Glyphs[rune(defaultChar)]; ok {
+		f.Fallback = g
+	} else {
+		f.Fallback = defaultFallback(f)
+	}
+	return f, nil
+}
+
+// bdfMaxGlyphSize is the largest glyph width or height ParseBDF accepts.
+const bdfMaxGlyphSize = 4096
+
+// checkBBX returns an error if the size in the BBX or FONTBOUNDINGBOX values v, read from the given line, is negative
+// or implausibly large.
+func checkBBX(v []int, line int) error {
+	if v[0] < 0 || v[1] < 0 || v[0] > bdfMaxGlyphSize || v[1] > bdfMaxGlyphSize {
+		return fmt.Errorf("line %d: invalid bounding box size %dx%d", line, v[0], v[1])
+	}
+	return nil
+}
+
+// defaultFallback returns f's glyph for U+FFFD, or failing that '?', or nil.
+func defaultFallback(f *BitmapFont) *Glyph {
+	if g, ok := f.Glyphs[utf8.RuneError]; ok {
+		return g
+	}
+	return f.Glyphs['?']
+}
+
+// PSF magic numbers.
+var (
+	psf1Magic = []byte{0x36, 0x04}
+	psf2Magic = []byte{0x72, 0xb5, 0x4a, 0x86}
+)
+
+// PSF1 mode flags.
+const (
+	psf1Mode512    = 0x01
+	psf1ModeHasTab = 0x02
+	psf1ModeSeq    = 0x04
+)
+
+// ParsePSF parses a Linux console font in PSF version 1 or 2, which may be gzipped. If the font has a Unicode table,
+// each glyph is keyed by every code point the table maps to it (sequences of combining characters are skipped);
+// otherwise glyphs are keyed by their index, which for most console fonts matches Unicode in the ASCII range only.
+// The fallback is the glyph for U+FFFD or '?', if either is present. PSF fonts don't record a baseline, so the whole
+// cell is taken as ascent.
+func ParsePSF(r io.Reader) (*BitmapFont, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	var count, width, height, charSize, headerSize int
+	var hasTable, psf2 bool
+	switch {
+	case bytes.HasPrefix(data, psf1Magic) && len(data) >= 4:
+		mode := data[2]
+		count, width, height, charSize, headerSize = 256, 8, int(data[3]), int(data[3]), 4
+		if mode&psf1Mode512 != 0 {
+			count = 512
+		}
+		hasTable = mode&(psf1ModeHasTab|psf1ModeSeq) != 0
+	case bytes.HasPrefix(data, psf2Magic) && len(data) >= 32:
+		le := binary.LittleEndian
+		headerSize = int(le.Uint32(data[8:]))
+		hasTable = le.Uint32(data[12:])&1 != 0
+		count, charSize = int(le.Uint32(data[16:])), int(le.Uint32(data[20:]))
+		height, width = int(le.Uint32(data[24:])), int(le.Uint32(data[28:]))
+		psf2 = true
+	default:
+		return nil, errors.New("not a PSF font")
+	}
+	if psf2 && (headerSize < 32 || headerSize > len(data)) {
+		return nil, errors.New("invalid PSF header")
+	}
+	// Each field is bounded by the size of the data before any are multiplied, so a corrupt header can't overflow.
+	if width < 1 || height < 1 || count < 1 || charSize < 1 || charSize > len(data)-headerSize ||
+		width > 8*charSize || height > charSize/((width+7)/8) {
+		return nil, errors.New("invalid PSF header")
+	}
+	if count > (len(data)-headerSize)/charSize {
+		return nil, fmt.Errorf("PSF font is truncated: %d glyphs of %d bytes need more than the %d found", count,
+			charSize, len(data)-headerSize)
+	}
+	end := headerSize + count*charSize
+
+	f := &BitmapFont{Name: "psf", Ascent: height, Glyphs: make(map[rune]*Glyph)}
+	glyphs := make([]*Glyph, count)
+	for i := range glyphs {
+		o := headerSize + i*charSize
+		glyphs[i] = &Glyph{Width: width, Height: height, YOffset: -height, Advance: width,
+			Bits: data[o : o+(width+7)/8*height : o+(width+7)/8*height]}
+	}
+
+	if !hasTable {
+		for i, g := range glyphs {
+			f.Glyphs[rune(i)] = g
+		}
+		f.Fallback = defaultFallback(f)
+		return f, nil
+	}
+
+	table := data[end:]
+	for i := 0; i < count && len(table) > 0; i++ {
+		inSeq := false
+		if psf2 {
+			// UTF-8 code points, with 0xFE starting a sequence and 0xFF ending the glyph's entry.
+			for len(table) > 0 {
+				b := table[0]
+				if b == 0xff {
+					table = table[1:]
+					break
+				}
+				if b == 0xfe {
+					inSeq, table = true, table[1:]
+					continue
+				}
+				c, n := utf8.DecodeRune(table)
+				table = table[n:]
+				if !inSeq && !(c == utf8.RuneError && n == 1) {
+					f.Glyphs[c] = glyphs[i]
+				}
+			}
+			continue
+		}
+		// UCS-2 code points, with 0xFFFE starting a sequence and 0xFFFF ending the glyph's entry.
+		for len(table) >= 2 {
+			c := binary.LittleEndian.Uint16(table)
+			table = table[2:]
+			if c == 0xffff {
+				break
+			}
+			if c == 0xfffe {
+				inSeq = true
+				continue
+			}
+			if !inSeq {
+				f.Glyphs[rune(c)] = glyphs[i]
+			}
+		}
+	}
+	f.Fallback = defaultFallback(f)
+	return f, nil
+}
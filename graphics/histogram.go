@@ -0,0 +1,321 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+)
+
+// Histogram counts how many values fall into each of 256 bins. For 8-bit formats each value has its own bin; 16-bit
+// values are binned by their high byte.
+type Histogram struct {
+	Bins [256]uint64
+	// Count is the total of Bins.
+	Count uint64
+}
+
+// Add adds other's counts to h.
+func (h *Histogram) Add(other *Histogram) {
+	for i, n := range other.Bins {
+		h.Bins[i] += n
+	}
+	h.Count += other.Count
+}
+
+// Mean returns the mean bin, or 0 if h is empty.
+func (h *Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	var sum float64
+	for i, n := range h.Bins {
+		sum += float64(i) * float64(n)
+	}
+	return sum / float64(h.Count)
+}
+
+// Percentile returns the smallest bin at or below which at least fraction p (in [0,1]) of the values fall; so
+// Percentile(0.5) is the median. It returns 0 if h is empty.
+func (h *Histogram) Percentile(p float64) uint8 {
+	target := uint64(math.Ceil(p * float64(h.Count)))
+	var cum uint64
+	for i, n := range h.Bins {
+		cum += n
+		if cum >= target && cum > 0 {
+			return uint8(i)
+		}
+	}
+	return 255
+}
+
+// maskFunc returns a function reporting whether the pixel at (x, y) is included by mask: where mask is non-nil, only
+// pixels where its alpha is non-zero are included.
+func maskFunc(mask image.Image) func(x, y int) bool {
+	switch m := mask.(type) {
+	case nil:
+		return func(x, y int) bool { return true }
+	case *image.Alpha:
+		return func(x, y int) bool {
+			return image.Pt(x, y).In(m.Rect) && m.Pix[m.PixOffset(x, y)] != 0
+		}
+	default:
+		return func(x, y int) bool {
+			_, _, _, a := m.At(x, y).RGBA()
+			return a != 0
+		}
+	}
+}
+
+// histogram accumulates n histograms per row range over the pixels of img within r (and mask), calling bin to fill
+// in the bin of each histogram for each pixel, and returns them merged. bin receives the pixel's offset in Pix and
+// its coordinates, and returns false if the pixel shouldn't be counted.
+func (img *Image) histogram(r image.Rectangle, mask image.Image, n int,
+	bin func(o, x, y int, bins []int) bool) []Histogram {
+	r = r.Intersect(img.Rect)
+	in := maskFunc(mask)
+	hs := make([]Histogram, n)
+	var mu sync.Mutex
+	parallelRows(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		local := make([]Histogram, n)
+		bins := make([]int, n)
+		for y := y0; y < y1; y++ {
+			o := img.offset(r.Min.X, y)
+			for x := r.Min.X; x < r.Max.X; x, o = x+1, o+img.bpp {
+				if !in(x, y) || !bin(o, x, y, bins) {
+					continue
+				}
+				for i, b := range bins {
+					local[i].Bins[b]++
+					local[i].Count++
+				}
+			}
+		}
+		mu.Lock()
+		for i := range hs {
+			hs[i].Add(&local[i])
+		}
+		mu.Unlock()
+	})
+	return hs
+}
+
+// Histograms returns the histogram of each channel (including alpha) of the pixels of img within r. If mask is
+// non-nil, only pixels where its alpha is non-zero are counted. Rows are processed in parallel.
+func (img *Image) Histograms(r image.Rectangle, mask image.Image) []Histogram {
+	return img.histogram(r, mask, img.channels(), func(o, x, y int, bins []int) bool {
+		for c := range bins {
+			bins[c] = int(img.Pix[o+c*img.depth])
+		}
+		return true
+	})
+}
+
+// LuminanceHistogram returns the histogram of the luma (see Grayscale) of the pixels of img within r. If mask is
+// non-nil, only pixels where its alpha is non-zero are counted. Fully transparent pixels, which have no color, aren't
+// counted either. RGB colors are un-premultiplied; for formats other than RGB and gray ones, pixels are read via At.
+// Rows are processed in parallel.
+func (img *Image) LuminanceHistogram(r image.Rectangle, mask image.Image) Histogram {
+	max := img.maxValue()
+	return img.histogram(r, mask, 1, func(o, x, y int, bins []int) bool {
+		if l, _, ok := img.luma(o); ok {
+			if img.alpha >= 0 && img.readChannel(o+img.alpha*img.depth) == 0 {
+				return false
+			}
+			bins[0] = int(math.Min(255, l*255/max))
+			return true
+		}
+		c := img.At(x, y)
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return false
+		}
+		bins[0] = int(color.GrayModel.Convert(c).(color.Gray).Y)
+		return true
+	})[0]
+}
+
+// isGray returns whether img has a single, non-alpha channel (as with image.Gray and Gray16), rather than palette
+// indices.
+func (img *Image) isGray() bool {
+	return img.channels() == 1 && img.alpha < 0 && !img.indexed
+}
+
+// luma returns the luma of the pixel at offset o, in the channel range, and its alpha as a fraction. RGB colors are
+// un-premultiplied. ok is false if img is neither an RGB nor a gray format.
+func (img *Image) luma(o int) (l, a float64, ok bool) {
+	if img.isGray() {
+		return img.readChannel(o), 1, true
+	}
+	if !img.isRGB() {
+		return 0, 0, false
+	}
+	a = 1
+	if img.premul {
+		if a = img.readChannel(o+3*img.depth) / img.maxValue(); a == 0 {
+			return 0, 0, true
+		}
+	}
+	l = 0.299*img.readChannel(o) + 0.587*img.readChannel(o+img.depth) + 0.114*img.readChannel(o+2*img.depth)
+	return l / a, a, true
+}
+
+// setLuma changes the luma of the pixel at offset o from l to nl (with a its alpha fraction, as returned by luma).
+// For RGB, the difference is added to each channel, which keeps the pixel's chroma (its Cb and Cr) unchanged.
+func (img *Image) setLuma(o int, l, nl, a float64) {
+	if img.isGray() {
+		img.writeChannel(o, nl)
+		return
+	}
+	d := (nl - l) * a
+	limit := img.maxValue()
+	if img.premul {
+		limit *= a
+	}
+	for c := 0; c < 3; c++ {
+		co := o + c*img.depth
+		img.writeChannel(co, math.Min(limit, img.readChannel(co)+d))
+	}
+}
+
+// EqualizationLUT returns the LUT which equalizes the distribution described by h: it maps each bin to its
+// cumulative fraction of the values, stretched so the lowest occupied bin maps to 0.
+func EqualizationLUT(h *Histogram) LUT {
+	var l LUT
+	var cdfMin, cum uint64
+	for _, n := range h.Bins {
+		if n != 0 {
+			cdfMin = n
+			break
+		}
+	}
+	if h.Count == cdfMin {
+		return IdentityLUT()
+	}
+	for i, n := range h.Bins {
+		cum += n
+		if cum < cdfMin {
+			continue
+		}
+		l[i] = uint8(math.Round(float64(cum-cdfMin) / float64(h.Count-cdfMin) * 255))
+	}
+	return l
+}
+
+// Equalize performs global histogram equalization on img, in place, spreading its luma (see Grayscale) across the
+// full range, which brings out detail in dim or washed-out images. RGB colors keep their chroma, and alpha is left
+// untouched. It only affects RGB and gray formats. Rows are processed in parallel.
+func (img *Image) Equalize() {
+	if !img.isRGB() && !img.isGray() {
+		return
+	}
+	h := img.LuminanceHistogram(img.Rect, nil)
+	lut := EqualizationLUT(&h)
+	max := img.maxValue()
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o = x+1, o+img.bpp {
+				if l, a, _ := img.luma(o); a > 0 {
+					img.setLuma(o, l, lut.mapValue(l, max), a)
+				}
+			}
+		}
+	})
+}
+
+// CLAHE performs contrast-limited adaptive histogram equalization on img, in place. img is divided into a
+// tilesX x tilesY grid and each tile's luma is equalized separately, with the histogram clipped at clipLimit times
+// the average bin count (and the excess redistributed evenly) to limit how much noise in flat regions is amplified;
+// 2 to 4 is typical, and values <= 1 disable the clipping. Each pixel is mapped by bilinearly interpolating between
+// the mappings of the four nearest tiles, so there are no seams.
+// As with Equalize, RGB colors keep their chroma, alpha is left untouched, and only RGB and gray formats are
+// affected. Rows are processed in parallel.
+func (img *Image) CLAHE(tilesX, tilesY int, clipLimit float64) {
+	if !img.isRGB() && !img.isGray() {
+		return
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if tilesX < 1 {
+		tilesX = 1
+	}
+	if tilesY < 1 {
+		tilesY = 1
+	}
+	if tilesX > w {
+		tilesX = w
+	}
+	if tilesY > h {
+		tilesY = h
+	}
+	if tilesX == 0 || tilesY == 0 {
+		return
+	}
+
+	// tileRect returns the bounds of tile (tx, ty); tiles split the image as evenly as possible.
+	tileRect := func(tx, ty int) image.Rectangle {
+		return image.Rect(tx*w/tilesX, ty*h/tilesY, (tx+1)*w/tilesX, (ty+1)*h/tilesY).Add(img.Rect.Min)
+	}
+	luts := make([]LUT, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			hist := img.LuminanceHistogram(tileRect(tx, ty), nil)
+			clipHistogram(&hist, clipLimit)
+			luts[ty*tilesX+tx] = EqualizationLUT(&hist)
+		}
+	}
+
+	max := img.maxValue()
+	// tileCoord returns the (fractional) tile index whose center is at pixel coordinate p (relative to the bounds'
+	// origin) along an axis of size n split into t tiles, clamped to the outer centers.
+	tileCoord := func(p, n, t int) (int, int, float64) {
+		f := (float64(p)+0.5)*float64(t)/float64(n) - 0.5
+		if f <= 0 {
+			return 0, 0, 0
+		}
+		if f >= float64(t-1) {
+			return t - 1, t - 1, 0
+		}
+		i := int(f)
+		return i, i + 1, f - float64(i)
+	}
+	parallelRows(0, h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			ty0, ty1, fy := tileCoord(y, h, tilesY)
+			o := img.offset(img.Rect.Min.X, img.Rect.Min.Y+y)
+			for x := 0; x < w; x, o = x+1, o+img.bpp {
+				l, a, _ := img.luma(o)
+				if a == 0 {
+					continue
+				}
+				tx0, tx1, fx := tileCoord(x, w, tilesX)
+				top := luts[ty0*tilesX+tx0].mapValue(l, max)*(1-fx) + luts[ty0*tilesX+tx1].mapValue(l, max)*fx
+				bottom := luts[ty1*tilesX+tx0].mapValue(l, max)*(1-fx) + luts[ty1*tilesX+tx1].mapValue(l, max)*fx
+				img.setLuma(o, l, top*(1-fy)+bottom*fy, a)
+			}
+		}
+	})
+}
+
+// clipHistogram clips each bin of h at limit times the average bin count, and redistributes the clipped excess
+// evenly across all the bins. A limit <= 1 leaves h unchanged.
+func clipHistogram(h *Histogram, limit float64) {
+	if limit <= 1 || h.Count == 0 {
+		return
+	}
+	clip := uint64(math.Max(1, limit*float64(h.Count)/256))
+	var excess uint64
+	for i, n := range h.Bins {
+		if n > clip {
+			excess += n - clip
+			h.Bins[i] = clip
+		}
+	}
+	each, rem := excess/256, excess%256
+	for i := range h.Bins {
+		h.Bins[i] += each
+	}
+	// Spread the remainder across the range rather than piling it at the bottom.
+	for i := uint64(0); i < rem; i++ {
+		h.Bins[i*256/rem]++
+	}
+}
@@ -0,0 +1,155 @@
+package graphics
+
+import "image"
+
+// IntegralImage is a summed-area table of an Image: for each channel, the sum of all the values above and to the
+// left of each point. Once built (in O(pixels) time), the sum or mean of any channel over any rectangle is found in
+// constant time, with four lookups.
+type IntegralImage struct {
+	// Rect is the bounds of the Image the table was built from.
+	Rect image.Rectangle
+
+	channels int
+	// stride is the number of sums per row: (Rect.Dx()+1) * channels, since there is a leading zero row and column.
+	stride int
+	sums   []uint64
+	// premultiplied is true if the color sums are of alpha-premultiplied values (see newIntegralImage).
+	premultiplied bool
+	alpha         int
+	maxValue      float64
+}
+
+// NewIntegralImage builds the summed-area table of every channel of img. The sums are of the raw channel values
+// (whatever their format), and are exact: a uint64 can't overflow summing the 16-bit values of any image that
+// fits in memory.
+func NewIntegralImage(img *Image) *IntegralImage {
+	return newIntegralImage(img, false)
+}
+
+// newIntegralImage builds the summed-area table of img. If premultiply is true and img has a non-premultiplied alpha
+// channel, the color channels are premultiplied (to the nearest integer) before being summed, so that averages
+// weight colors by their opacity.
+func newIntegralImage(img *Image, premultiply bool) *IntegralImage {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	ch := img.channels()
+	ii := &IntegralImage{
+		Rect:          img.Rect,
+		channels:      ch,
+		stride:        (w + 1) * ch,
+		premultiplied: premultiply && img.alpha >= 0 && !img.premul,
+		alpha:         img.alpha,
+		maxValue:      img.maxValue(),
+	}
+	ii.sums = make([]uint64, (h+1)*ii.stride)
+
+	// Row prefix sums are independent, so are done in parallel; adding in the row above has to go in order.
+	parallelRows(0, h, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			row := ii.sums[(y+1)*ii.stride : (y+2)*ii.stride]
+			o := img.offset(img.Rect.Min.X, img.Rect.Min.Y+y)
+			for x := 0; x < w; x++ {
+				var a float64
+				if ii.premultiplied {
+					a = img.readChannel(o+img.alpha*img.depth) / ii.maxValue
+				}
+				for c := 0; c < ch; c++ {
+					v := uint64(img.readChannel(o + c*img.depth))
+					if ii.premultiplied && c != img.alpha {
+						v = uint64(float64(v)*a + 0.5)
+					}
+					i := (x+1)*ch + c
+					row[i] = row[i-ch] + v
+				}
+				o += img.bpp
+			}
+		}
+	})
+	for y := 1; y <= h; y++ {
+		row, above := ii.sums[y*ii.stride:(y+1)*ii.stride], ii.sums[(y-1)*ii.stride:y*ii.stride]
+		for i := range row {
+			row[i] += above[i]
+		}
+	}
+	return ii
+}
+
+// Channels returns the number of channels summed.
+func (ii *IntegralImage) Channels() int {
+	return ii.channels
+}
+
+// Sum returns the sum of channel c over the pixels within r (which is clipped to ii.Rect).
+func (ii *IntegralImage) Sum(r image.Rectangle, c int) uint64 {
+	r = r.Intersect(ii.Rect)
+	if r.Empty() {
+		return 0
+	}
+	r = r.Sub(ii.Rect.Min)
+	top, bottom := r.Min.Y*ii.stride, r.Max.Y*ii.stride
+	left, right := r.Min.X*ii.channels+c, r.Max.X*ii.channels+c
+	return ii.sums[bottom+right] - ii.sums[bottom+left] - ii.sums[top+right] + ii.sums[top+left]
+}
+
+// Mean returns the mean of channel c over the pixels within r (which is clipped to ii.Rect), or 0 if that's empty.
+func (ii *IntegralImage) Mean(r image.Rectangle, c int) float64 {
+	r = r.Intersect(ii.Rect)
+	n := r.Dx() * r.Dy()
+	if n == 0 {
+		return 0
+	}
+	return float64(ii.Sum(r, c)) / float64(n)
+}
+
+// Means writes the mean of every channel over the pixels within r (which is clipped to ii.Rect) into px, which must
+// have at least Channels() elements. If r is empty, the means are all 0.
+func (ii *IntegralImage) Means(r image.Rectangle, px []float64) {
+	r = r.Intersect(ii.Rect)
+	n := float64(r.Dx() * r.Dy())
+	for c := 0; c < ii.channels; c++ {
+		if n == 0 {
+			px[c] = 0
+		} else {
+			px[c] = float64(ii.Sum(r, c)) / n
+		}
+	}
+}
+
+// FastBoxBlur returns a new Image holding src blurred by averaging the (2*radius+1)^2 pixel square around each
+// pixel. It uses a summed-area table, so its cost doesn't depend on radius. Unlike BoxBlur, which clamps the edges,
+// only the pixels within src are averaged at the edges; for other edge handling, use ConvolveSeparable with
+// BoxBlurKernel.
+// If src has a non-premultiplied alpha channel, colors are weighted by alpha, so transparent pixels don't bleed
+// color into their neighbors.
+func FastBoxBlur(src *Image, radius int) (*Image, error) {
+	dst, err := NewImageLike(src, src.Rect)
+	if err != nil {
+		return nil, err
+	}
+	if radius < 0 {
+		radius = 0
+	}
+	ii := newIntegralImage(src, true)
+	ch := src.channels()
+	parallelRows(src.Rect.Min.Y, src.Rect.Max.Y, func(y0, y1 int) {
+		px := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			o := dst.offset(dst.Rect.Min.X, y)
+			for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+				ii.Means(image.Rect(x-radius, y-radius, x+radius+1, y+radius+1), px)
+				for c := 0; c < ch; c++ {
+					v := px[c]
+					if ii.premultiplied && c != ii.alpha {
+						if a := px[ii.alpha]; a > 0 {
+							v = v * ii.maxValue / a
+						} else {
+							v = 0
+						}
+					}
+					dst.writeChannel(o+c*dst.depth, v)
+				}
+				o += dst.bpp
+			}
+		}
+	})
+	return dst, nil
+}
@@ -0,0 +1,245 @@
+package graphics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LUT3D is a 3D color lookup table, as used for color grading: a Size x Size x Size lattice of output RGB colors
+// spanning the input RGB cube, which is interpolated between.
+type LUT3D struct {
+	// Title is the LUT's title, if the file had one.
+	Title string
+	// Size is the number of lattice points along each axis.
+	Size int
+	// DomainMin and DomainMax are the input values mapped to the first and last lattice points of each axis
+	// (normally 0 and 1). Inputs outside the domain are clamped to it.
+	DomainMin, DomainMax [3]float64
+	// Data holds the Size^3 output colors, with red varying fastest, then green, then blue (the .cube order).
+	Data [][3]float32
+}
+
+// LUT3DInterpolation selects how a LUT3D is interpolated between lattice points.
+type LUT3DInterpolation int
+
+const (
+	// LUTTrilinear interpolates between the 8 lattice points of the enclosing cube.
+	LUTTrilinear LUT3DInterpolation = iota
+	// LUTTetrahedral interpolates between the 4 lattice points of the enclosing tetrahedron. It is cheaper than
+	// trilinear, and generally more accurate along the neutral (gray) axis, which is why most grading tools use it.
+	LUTTetrahedral
+)
+
+// LoadCubeLUT loads a 3D LUT from the Adobe/Resolve .cube file at path. See ParseCubeLUT.
+func LoadCubeLUT(path string) (*LUT3D, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCubeLUT(f)
+}
+
+// ParseCubeLUT parses a 3D LUT in the Adobe/Resolve .cube format: a TITLE, LUT_3D_SIZE and optional DOMAIN_MIN and
+// DOMAIN_MAX (or Resolve's LUT_3D_INPUT_RANGE) keywords, followed by Size^3 lines of output RGB triples with red
+// varying fastest. Comments (#) and blank lines are ignored. 1D LUTs (LUT_1D_SIZE) are not supported.
+func ParseCubeLUT(r io.Reader) (*LUT3D, error) {
+	l := &LUT3D{DomainMax: [3]float64{1, 1, 1}}
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		s := sc.Text()
+		if i := strings.IndexByte(s, '#'); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch key := fields[0]; key {
+		case "TITLE":
+			l.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "TITLE")), `"`)
+			continue
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("line %d: 1D LUTs are not supported", line)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: LUT_3D_SIZE needs one value", line)
+			}
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 2 || n > 256 {
+				return nil, fmt.Errorf("line %d: invalid LUT_3D_SIZE %q", line, fields[1])
+			}
+			l.Size = n
+			l.Data = make([][3]float32, 0, n*n*n)
+			continue
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", line, key, err)
+			}
+			if key == "DOMAIN_MIN" {
+				copy(l.DomainMin[:], v)
+			} else {
+				copy(l.DomainMax[:], v)
+			}
+			continue
+		case "LUT_3D_INPUT_RANGE":
+			v, err := parseFloats(fields[1:], 2)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", line, key, err)
+			}
+			l.DomainMin = [3]float64{v[0], v[0], v[0]}
+			l.DomainMax = [3]float64{v[1], v[1], v[1]}
+			continue
+		}
+
+		// Anything else must be a data line, though some tools add keywords of their own, which are skipped.
+		if c := fields[0][0]; (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' {
+			continue
+		}
+		if l.Size == 0 {
+			return nil, fmt.Errorf("line %d: data before LUT_3D_SIZE", line)
+		}
+		v, err := parseFloats(fields, 3)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(l.Data) == cap(l.Data) {
+			return nil, fmt.Errorf("line %d: more than LUT_3D_SIZE^3 (%d) entries", line, cap(l.Data))
+		}
+		l.Data = append(l.Data, [3]float32{float32(v[0]), float32(v[1]), float32(v[2])})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if l.Size == 0 {
+		return nil, errors.New("no LUT_3D_SIZE")
+	}
+	if len(l.Data) != cap(l.Data) {
+		return nil, fmt.Errorf("expected %d entries, found %d", cap(l.Data), len(l.Data))
+	}
+	for i := range l.DomainMin {
+		if l.DomainMax[i] <= l.DomainMin[i] {
+			return nil, errors.New("DOMAIN_MAX must be greater than DOMAIN_MIN")
+		}
+	}
+	return l, nil
+}
+
+// parseFloats parses exactly n floats from fields.
+func parseFloats(fields []string, n int) ([]float64, error) {
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %d values, found %d", n, len(fields))
+	}
+	v := make([]float64, n)
+	for i, f := range fields {
+		var err error
+		if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// at returns the lattice point at (ri, gi, bi).
+func (l *LUT3D) at(ri, gi, bi int) [3]float64 {
+	p := l.Data[(bi*l.Size+gi)*l.Size+ri]
+	return [3]float64{float64(p[0]), float64(p[1]), float64(p[2])}
+}
+
+// Lookup maps the color (r, g, b) through l, with interp.
+func (l *LUT3D) Lookup(r, g, b float64, interp LUT3DInterpolation) (float64, float64, float64) {
+	var idx [3]int
+	var frac [3]float64
+	n := float64(l.Size - 1)
+	for i, v := range [3]float64{r, g, b} {
+		t := (v - l.DomainMin[i]) / (l.DomainMax[i] - l.DomainMin[i]) * n
+		t = math.Max(0, math.Min(n, t))
+		f := math.Floor(t)
+		if f == n {
+			// Keep the upper neighbor in range; the fraction is then 1 rather than 0.
+			f--
+		}
+		idx[i], frac[i] = int(f), t-f
+	}
+	ri, gi, bi := idx[0], idx[1], idx[2]
+	fr, fg, fb := frac[0], frac[1], frac[2]
+	c000 := l.at(ri, gi, bi)
+	c111 := l.at(ri+1, gi+1, bi+1)
+
+	var out [3]float64
+	if interp == LUTTetrahedral {
+		// Each tetrahedron walks from c000 to c111 along the cube edges in order of decreasing fraction.
+		var c1, c2 [3]float64
+		var f0, f1, f2 float64
+		switch {
+		case fr > fg && fg > fb:
+			c1, c2, f0, f1, f2 = l.at(ri+1, gi, bi), l.at(ri+1, gi+1, bi), fr, fg, fb
+		case fr > fg && fr > fb:
+			c1, c2, f0, f1, f2 = l.at(ri+1, gi, bi), l.at(ri+1, gi, bi+1), fr, fb, fg
+		case fr > fg:
+			c1, c2, f0, f1, f2 = l.at(ri, gi, bi+1), l.at(ri+1, gi, bi+1), fb, fr, fg
+		case fb > fg:
+			c1, c2, f0, f1, f2 = l.at(ri, gi, bi+1), l.at(ri, gi+1, bi+1), fb, fg, fr
+		case fb > fr:
+			c1, c2, f0, f1, f2 = l.at(ri, gi+1, bi), l.at(ri, gi+1, bi+1), fg, fb, fr
+		default:
+			c1, c2, f0, f1, f2 = l.at(ri, gi+1, bi), l.at(ri+1, gi+1, bi), fg, fr, fb
+		}
+		for i := range out {
+			out[i] = c000[i] + f0*(c1[i]-c000[i]) + f1*(c2[i]-c1[i]) + f2*(c111[i]-c2[i])
+		}
+		return out[0], out[1], out[2]
+	}
+
+	c100, c010, c110 := l.at(ri+1, gi, bi), l.at(ri, gi+1, bi), l.at(ri+1, gi+1, bi)
+	c001, c101, c011 := l.at(ri, gi, bi+1), l.at(ri+1, gi, bi+1), l.at(ri, gi+1, bi+1)
+	for i := range out {
+		c00 := c000[i] + (c100[i]-c000[i])*fr
+		c10 := c010[i] + (c110[i]-c010[i])*fr
+		c01 := c001[i] + (c101[i]-c001[i])*fr
+		c11 := c011[i] + (c111[i]-c011[i])*fr
+		c0 := c00 + (c10-c00)*fg
+		c1 := c01 + (c11-c01)*fg
+		out[i] = c0 + (c1-c0)*fb
+	}
+	return out[0], out[1], out[2]
+}
+
+// ApplyLUT3D maps the color of every pixel of img through l, with interp, in place. Values are normalized to [0,1]
+// for the lookup (so a LUT with the usual 0-1 domain applies to any depth), and alpha is left untouched;
+// premultiplied colors are un-premultiplied for the lookup.
+// Like Grayscale, it only affects RGB formats. Rows are processed in parallel.
+func (img *Image) ApplyLUT3D(l *LUT3D, interp LUT3DInterpolation) {
+	if !img.isRGB() {
+		return
+	}
+	max := img.maxValue()
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o = x+1, o+img.bpp {
+				a := 1.0
+				if img.premul {
+					if a = img.readChannel(o+3*img.depth) / max; a == 0 {
+						continue
+					}
+				}
+				r, g, b := l.Lookup(img.readChannel(o)/max/a, img.readChannel(o+img.depth)/max/a,
+					img.readChannel(o+2*img.depth)/max/a, interp)
+				img.writeChannel(o, clamp01(r)*a*max)
+				img.writeChannel(o+img.depth, clamp01(g)*a*max)
+				img.writeChannel(o+2*img.depth, clamp01(b)*a*max)
+			}
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package graphics
+
+import "math"
+
+// Vec3 is a point (or vector) in 3D space.
+type Vec3 struct {
+	X, Y, Z float64
+}
+
+// Add returns v + w.
+func (v Vec3) Add(w Vec3) Vec3 {
+	return Vec3{v.X + w.X, v.Y + w.Y, v.Z + w.Z}
+}
+
+// Sub returns v - w.
+func (v Vec3) Sub(w Vec3) Vec3 {
+	return Vec3{v.X - w.X, v.Y - w.Y, v.Z - w.Z}
+}
+
+// Scale returns v * s.
+func (v Vec3) Scale(s float64) Vec3 {
+	return Vec3{v.X * s, v.Y * s, v.Z * s}
+}
+
+// Dot returns the dot product of v and w.
+func (v Vec3) Dot(w Vec3) float64 {
+	return v.X*w.X + v.Y*w.Y + v.Z*w.Z
+}
+
+// Cross returns the cross product v x w.
+func (v Vec3) Cross(w Vec3) Vec3 {
+	return Vec3{v.Y*w.Z - v.Z*w.Y, v.Z*w.X - v.X*w.Z, v.X*w.Y - v.Y*w.X}
+}
+
+// Len returns the length of v.
+func (v Vec3) Len() float64 {
+	return math.Sqrt(v.Dot(v))
+}
+
+// Normalize returns v scaled to length 1, or v itself if it has length 0.
+func (v Vec3) Normalize() Vec3 {
+	if l := v.Len(); l > 0 {
+		return v.Scale(1 / l)
+	}
+	return v
+}
+
+// Vec4 is a point in homogeneous coordinates, representing the 3D point (X/W, Y/W, Z/W).
+type Vec4 struct {
+	X, Y, Z, W float64
+}
+
+// lerp returns the point t of the way from v to w.
+func (v Vec4) lerp(w Vec4, t float64) Vec4 {
+	return Vec4{v.X + (w.X-v.X)*t, v.Y + (w.Y-v.Y)*t, v.Z + (w.Z-v.Z)*t, v.W + (w.W-v.W)*t}
+}
+
+// Mat4 is a 4x4 transformation matrix for 3D (homogeneous) coordinates, in row-major order, which transforms column
+// vectors: row i of the result is the dot product of row i of the matrix with the vector.
+// Like OpenGL, the 3D pipeline uses right-handed coordinates, with the camera looking down -Z and Y up.
+type Mat4 [16]float64
+
+// IdentityMat4 returns the identity transformation.
+func IdentityMat4() Mat4 {
+	return Mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+// TranslateMat4 returns a transformation which translates by (tx, ty, tz).
+func TranslateMat4(tx, ty, tz float64) Mat4 {
+	return Mat4{1, 0, 0, tx, 0, 1, 0, ty, 0, 0, 1, tz, 0, 0, 0, 1}
+}
+
+// ScaleMat4 returns a transformation which scales by sx, sy and sz along the axes, about the origin.
+func ScaleMat4(sx, sy, sz float64) Mat4 {
+	return Mat4{sx, 0, 0, 0, 0, sy, 0, 0, 0, 0, sz, 0, 0, 0, 0, 1}
+}
+
+// RotateXMat4 returns a transformation which rotates by theta radians about the X axis (counter-clockwise looking
+// down the axis toward the origin, as are the other rotations).
+func RotateXMat4(theta float64) Mat4 {
+	sin, cos := math.Sincos(theta)
+	return Mat4{1, 0, 0, 0, 0, cos, -sin, 0, 0, sin, cos, 0, 0, 0, 0, 1}
+}
+
+// RotateYMat4 returns a transformation which rotates by theta radians about the Y axis.
+func RotateYMat4(theta float64) Mat4 {
+	sin, cos := math.Sincos(theta)
+	return Mat4{cos, 0, sin, 0, 0, 1, 0, 0, -sin, 0, cos, 0, 0, 0, 0, 1}
+}
+
+// RotateZMat4 returns a transformation which rotates by theta radians about the Z axis.
+func RotateZMat4(theta float64) Mat4 {
+	sin, cos := math.Sincos(theta)
+	return Mat4{cos, -sin, 0, 0, sin, cos, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+// PerspectiveMat4 returns a perspective projection (as gluPerspective), with a vertical field of view of fovY
+// radians, a width/height aspect ratio of aspect, and near and far clipping planes at distances near and far (both
+// positive) in front of the camera. It maps the visible region onto the cube from (-1,-1,-1) to (1,1,1).
+func PerspectiveMat4(fovY, aspect, near, far float64) Mat4 {
+	f := 1 / math.Tan(fovY/2)
+	nf := 1 / (near - far)
+	return Mat4{
+		f / aspect, 0, 0, 0,
+		0, f, 0, 0,
+		0, 0, (far + near) * nf, 2 * far * near * nf,
+		0, 0, -1, 0,
+	}
+}
+
+// OrthoMat4 returns an orthographic projection (as glOrtho), mapping the box from (left, bottom, -near) to
+// (right, top, -far) onto the cube from (-1,-1,-1) to (1,1,1).
+func OrthoMat4(left, right, bottom, top, near, far float64) Mat4 {
+	return Mat4{
+		2 / (right - left), 0, 0, -(right + left) / (right - left),
+		0, 2 / (top - bottom), 0, -(top + bottom) / (top - bottom),
+		0, 0, -2 / (far - near), -(far + near) / (far - near),
+		0, 0, 0, 1,
+	}
+}
+
+// LookAtMat4 returns a view transformation (as gluLookAt) for a camera at eye looking toward target, with up giving
+// the direction which appears upward.
+func LookAtMat4(eye, target, up Vec3) Mat4 {
+	f := target.Sub(eye).Normalize()
+	s := f.Cross(up).Normalize()
+	u := s.Cross(f)
+	return Mat4{
+		s.X, s.Y, s.Z, -s.Dot(eye),
+		u.X, u.Y, u.Z, -u.Dot(eye),
+		-f.X, -f.Y, -f.Z, f.Dot(eye),
+		0, 0, 0, 1,
+	}
+}
+
+// Mul returns the product m*n, which is the transformation that applies n and then m.
+// So a model-view-projection matrix is projection.Mul(view).Mul(model).
+func (m Mat4) Mul(n Mat4) Mat4 {
+	var p Mat4
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			p[r*4+c] = m[r*4]*n[c] + m[r*4+1]*n[4+c] + m[r*4+2]*n[8+c] + m[r*4+3]*n[12+c]
+		}
+	}
+	return p
+}
+
+// Transform returns m*v.
+func (m Mat4) Transform(v Vec4) Vec4 {
+	return Vec4{
+		m[0]*v.X + m[1]*v.Y + m[2]*v.Z + m[3]*v.W,
+		m[4]*v.X + m[5]*v.Y + m[6]*v.Z + m[7]*v.W,
+		m[8]*v.X + m[9]*v.Y + m[10]*v.Z + m[11]*v.W,
+		m[12]*v.X + m[13]*v.Y + m[14]*v.Z + m[15]*v.W,
+	}
+}
+
+// Apply transforms the point p, returning the result in homogeneous coordinates (so that a projection's W is kept).
+func (m Mat4) Apply(p Vec3) Vec4 {
+	return m.Transform(Vec4{p.X, p.Y, p.Z, 1})
+}
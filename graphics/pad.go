@@ -0,0 +1,89 @@
+package graphics
+
+import (
+	"errors"
+	"image"
+)
+
+// Pad returns a copy of img with left, top, right and bottom pixels added to each side, filled according to edge:
+// with the constant pixelBytes for EdgeConstant (as with SetPixel, only the first n bytes of a pixel may be provided;
+// the rest are zero), or by repeating, wrapping or mirroring img's pixels for EdgeClamp, EdgeWrap and EdgeMirror.
+// Padding by a kernel's radius before convolving lets the result be cropped back without edge effects, and padding an
+// atlas tile with EdgeClamp gives it bleed margins. The result's bounds start at (0, 0). See ExtendCanvas.
+func Pad(img *Image, left, top, right, bottom int, edge EdgeMode, constant ...uint8) (*Image, error) {
+	if left < 0 || top < 0 || right < 0 || bottom < 0 {
+		return nil, errors.New("padding cannot be negative")
+	}
+	size := img.Rect.Size().Add(image.Pt(left+right, top+bottom))
+	return ExtendCanvas(img, size, image.Pt(left, top), edge, constant...)
+}
+
+// ExtendCanvas returns a new image of the given size (with bounds starting at (0, 0)), with img's top-left corner
+// placed at offset and the area outside img filled according to edge, as for Pad. Parts of img falling outside the
+// new bounds are cropped. For letterboxing, offset centers img: size.Sub(img.Rect.Size()).Div(2).
+// Only the image types NewImageLike can create are supported.
+func ExtendCanvas(img *Image, size, offset image.Point, edge EdgeMode, constant ...uint8) (*Image, error) {
+	if size.X < 0 || size.Y < 0 {
+		return nil, errors.New("canvas size cannot be negative")
+	}
+	if len(constant) > img.bpp {
+		return nil, errors.New("constant has more bytes than a pixel")
+	}
+	dst, err := NewImageLike(img, image.Rectangle{Max: size})
+	if err != nil {
+		return nil, err
+	}
+	// An empty image has no pixels to replicate.
+	if img.Rect.Empty() {
+		edge = EdgeConstant
+	}
+	fill := make([]uint8, img.bpp)
+	copy(fill, constant)
+
+	// cols[x] is the source column for destination column x, or -1 for the constant. The columns img covers
+	// directly, [x0, x1), are copied as a block.
+	r := img.Rect
+	cols := make([]int, size.X)
+	for x := range cols {
+		sx, ok := edgeCoord(x-offset.X+r.Min.X, r.Min.X, r.Max.X, edge)
+		if !ok {
+			sx = -1
+		}
+		cols[x] = sx
+	}
+	x0, x1 := offset.X, offset.X+r.Dx()
+	if x0 < 0 {
+		x0 = 0
+	}
+	if x1 > size.X {
+		x1 = size.X
+	}
+
+	parallelRows(0, size.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			row := dst.Pix[y*dst.Stride : y*dst.Stride+size.X*dst.bpp]
+			sy, ok := edgeCoord(y-offset.Y+r.Min.Y, r.Min.Y, r.Max.Y, edge)
+			if !ok {
+				for o := 0; o < len(row); o += dst.bpp {
+					copy(row[o:], fill)
+				}
+				continue
+			}
+			for x, sx := range cols {
+				if x == x0 && x0 < x1 {
+					copy(row[x0*dst.bpp:x1*dst.bpp], img.Pix[img.offset(r.Min.X+x0-offset.X, sy):])
+				}
+				if x >= x0 && x < x1 {
+					continue
+				}
+				if sx < 0 {
+					copy(row[x*dst.bpp:], fill)
+				} else {
+					o := img.offset(sx, sy)
+					copy(row[x*dst.bpp:], img.Pix[o:o+img.bpp])
+				}
+			}
+		}
+	})
+	return dst, nil
+}
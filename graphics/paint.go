@@ -0,0 +1,156 @@
+package graphics
+
+import (
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Paint supplies a color for each pixel, for filling shapes with something other than a single color (see
+// DrawFilledRectWithPaint, DrawFilledCircleWithPaint and DrawFilledPolygonWithPaint).
+type Paint interface {
+	// ColorAt returns the color at pixel (x, y).
+	ColorAt(x, y int) color.NRGBA64
+}
+
+// SolidPaint is a Paint of a single color.
+type SolidPaint color.NRGBA64
+
+// NewSolidPaint returns a SolidPaint of c.
+func NewSolidPaint(c color.Color) SolidPaint {
+	return SolidPaint(color.NRGBA64Model.Convert(c).(color.NRGBA64))
+}
+
+// ColorAt returns p's color.
+func (p SolidPaint) ColorAt(x, y int) color.NRGBA64 {
+	return color.NRGBA64(p)
+}
+
+// ColorStop is a color at a position (from 0 at the start to 1 at the end) along a gradient.
+type ColorStop struct {
+	Offset float64
+	Color  color.Color
+}
+
+// Spread selects how a gradient continues beyond its ends.
+type Spread int
+
+const (
+	// SpreadPad continues the end colors.
+	SpreadPad Spread = iota
+	// SpreadRepeat repeats the gradient.
+	SpreadRepeat
+	// SpreadReflect repeats the gradient, alternately reversed, so there are no sudden changes.
+	SpreadReflect
+)
+
+// Gradient holds what is common to the gradient paints: the color stops, and how the gradient continues beyond them.
+// Colors are interpolated with premultiplied alpha, so fading to a transparent stop doesn't darken or tint.
+type Gradient struct {
+	// Stops must be in order of Offset. Before the first stop and after the last, their colors continue.
+	Stops  []ColorStop
+	Spread Spread
+}
+
+// colorAt returns the color at position t along g, after applying the spread.
+func (g *Gradient) colorAt(t float64) color.NRGBA64 {
+	if len(g.Stops) == 0 {
+		return color.NRGBA64{}
+	}
+	switch g.Spread {
+	case SpreadRepeat:
+		t -= math.Floor(t)
+	case SpreadReflect:
+		t = math.Mod(math.Abs(t), 2)
+		if t > 1 {
+			t = 2 - t
+		}
+	}
+	stops := g.Stops
+	i := sort.Search(len(stops), func(i int) bool { return stops[i].Offset > t })
+	if i == 0 {
+		return color.NRGBA64Model.Convert(stops[0].Color).(color.NRGBA64)
+	}
+	if i == len(stops) {
+		return color.NRGBA64Model.Convert(stops[i-1].Color).(color.NRGBA64)
+	}
+	a, b := stops[i-1], stops[i]
+	f := 0.0
+	if b.Offset > a.Offset {
+		f = (t - a.Offset) / (b.Offset - a.Offset)
+	}
+	// RGBA returns premultiplied values, which are what should be interpolated.
+	ar, ag, ab, aa := a.Color.RGBA()
+	br, bg, bb, ba := b.Color.RGBA()
+	lerp := func(x, y uint32) float64 { return float64(x) + (float64(y)-float64(x))*f }
+	alpha := lerp(aa, ba)
+	if alpha == 0 {
+		return color.NRGBA64{}
+	}
+	un := func(v float64) uint16 { return uint16(math.Min(65535, v*65535/alpha+0.5)) }
+	return color.NRGBA64{R: un(lerp(ar, br)), G: un(lerp(ag, bg)), B: un(lerp(ab, bb)), A: uint16(alpha + 0.5)}
+}
+
+// LinearGradient is a Paint which varies along the line from (X0, Y0), at offset 0, to (X1, Y1), at offset 1, and is
+// constant at right angles to it.
+// As with all the gradients, coordinates are in pixels, and the color of a pixel is that at its center, so pixel
+// (x, y) takes the color at (x+0.5, y+0.5).
+type LinearGradient struct {
+	Gradient
+	X0, Y0, X1, Y1 float64
+}
+
+// NewLinearGradient returns a LinearGradient from (x0, y0) to (x1, y1) with stops, and SpreadPad.
+func NewLinearGradient(x0, y0, x1, y1 float64, stops ...ColorStop) *LinearGradient {
+	return &LinearGradient{Gradient: Gradient{Stops: stops}, X0: x0, Y0: y0, X1: x1, Y1: y1}
+}
+
+// ColorAt returns the color at pixel (x, y).
+func (g *LinearGradient) ColorAt(x, y int) color.NRGBA64 {
+	dx, dy := g.X1-g.X0, g.Y1-g.Y0
+	l := dx*dx + dy*dy
+	if l == 0 {
+		return g.colorAt(0)
+	}
+	return g.colorAt(((float64(x)+0.5-g.X0)*dx + (float64(y)+0.5-g.Y0)*dy) / l)
+}
+
+// RadialGradient is a Paint which varies from the center (CX, CY), at offset 0, out to the circle of radius R, at
+// offset 1.
+type RadialGradient struct {
+	Gradient
+	CX, CY, R float64
+}
+
+// NewRadialGradient returns a RadialGradient centered on (cx, cy) with radius r and stops, and SpreadPad.
+func NewRadialGradient(cx, cy, r float64, stops ...ColorStop) *RadialGradient {
+	return &RadialGradient{Gradient: Gradient{Stops: stops}, CX: cx, CY: cy, R: r}
+}
+
+// ColorAt returns the color at pixel (x, y).
+func (g *RadialGradient) ColorAt(x, y int) color.NRGBA64 {
+	if g.R <= 0 {
+		return g.colorAt(1)
+	}
+	return g.colorAt(math.Hypot(float64(x)+0.5-g.CX, float64(y)+0.5-g.CY) / g.R)
+}
+
+// ConicGradient is a Paint which varies with the angle around (CX, CY): clockwise (on screen) from offset 0 at
+// Angle radians (with 0 pointing right) through a full turn to offset 1. Being periodic already, it ignores Spread.
+type ConicGradient struct {
+	Gradient
+	CX, CY, Angle float64
+}
+
+// NewConicGradient returns a ConicGradient around (cx, cy), starting at angle, with stops.
+func NewConicGradient(cx, cy, angle float64, stops ...ColorStop) *ConicGradient {
+	return &ConicGradient{Gradient: Gradient{Stops: stops}, CX: cx, CY: cy, Angle: angle}
+}
+
+// ColorAt returns the color at pixel (x, y).
+func (g *ConicGradient) ColorAt(x, y int) color.NRGBA64 {
+	// With y down, atan2 increases clockwise on screen.
+	a := math.Atan2(float64(y)+0.5-g.CY, float64(x)+0.5-g.CX) - g.Angle
+	t := a / (2 * math.Pi)
+	return g.colorAt(t - math.Floor(t))
+}
@@ -0,0 +1,40 @@
+package graphics
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minParallelRows is the number of rows below which parallelRows doesn't bother spinning up goroutines.
+const minParallelRows = 16
+
+// parallelRows splits the rows [y0,y1) into contiguous ranges, one per available CPU, and calls fn for each range on
+// its own goroutine, returning once all of them have finished. fn must only write to the rows it is given.
+// Small row counts are handled on the calling goroutine, since the goroutine overhead outweighs the gain.
+func parallelRows(y0, y1 int, fn func(y0, y1 int)) {
+	n := y1 - y0
+	if n <= 0 {
+		return
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n/minParallelRows {
+		workers = n / minParallelRows
+	}
+	if workers <= 1 {
+		fn(y0, y1)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		// Spread the remainder over the first n%workers ranges rather than dumping it on the last one.
+		start := y0 + i*n/workers
+		end := y0 + (i+1)*n/workers
+		go func() {
+			defer wg.Done()
+			fn(start, end)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,560 @@
+package graphics
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// pathVerb identifies a Path segment type, and so how many points it uses.
+type pathVerb uint8
+
+const (
+	verbMoveTo pathVerb = iota
+	verbLineTo
+	verbQuadTo
+	verbCubicTo
+	verbClose
+)
+
+// pathTolerance is the furthest (in pixels) a flattened curve may stray from the true one.
+const pathTolerance = 0.2
+
+// Path is a vector shape built of straight lines and Bézier curves, made up of subpaths which may each be open or
+// closed. It can be filled (FillPath) or stroked (StrokePath) onto an Image. Coordinates are in pixels, with pixel
+// (x, y) covering the square from (x, y) to (x+1, y+1).
+// The zero value is an empty path ready to use. The building methods return the path, so calls can be chained.
+type Path struct {
+	verbs []pathVerb
+	// pts holds the points of each verb in turn: 1 for MoveTo and LineTo, 2 for QuadTo, 3 for CubicTo and none for
+	// Close.
+	pts []Vec2
+	// start is the first point of the current subpath, and cur the current point; open is whether there is one.
+	start, cur Vec2
+	open       bool
+}
+
+// MoveTo starts a new subpath at (x, y).
+func (p *Path) MoveTo(x, y float64) *Path {
+	p.verbs = append(p.verbs, verbMoveTo)
+	p.pts = append(p.pts, Vec2{x, y})
+	p.start, p.cur, p.open = Vec2{x, y}, Vec2{x, y}, true
+	return p
+}
+
+// ensureOpen starts a subpath at the current point (or the origin) if there isn't one, as after Close.
+func (p *Path) ensureOpen() {
+	if !p.open {
+		p.MoveTo(p.cur.X, p.cur.Y)
+	}
+}
+
+// LineTo adds a straight line from the current point to (x, y).
+func (p *Path) LineTo(x, y float64) *Path {
+	p.ensureOpen()
+	p.verbs = append(p.verbs, verbLineTo)
+	p.pts = append(p.pts, Vec2{x, y})
+	p.cur = Vec2{x, y}
+	return p
+}
+
+// QuadTo adds a quadratic Bézier curve from the current point to (x, y), with control point (cx, cy).
+func (p *Path) QuadTo(cx, cy, x, y float64) *Path {
+	p.ensureOpen()
+	p.verbs = append(p.verbs, verbQuadTo)
+	p.pts = append(p.pts, Vec2{cx, cy}, Vec2{x, y})
+	p.cur = Vec2{x, y}
+	return p
+}
+
+// CubicTo adds a cubic Bézier curve from the current point to (x, y), with control points (c1x, c1y) and
+// (c2x, c2y).
+func (p *Path) CubicTo(c1x, c1y, c2x, c2y, x, y float64) *Path {
+	p.ensureOpen()
+	p.verbs = append(p.verbs, verbCubicTo)
+	p.pts = append(p.pts, Vec2{c1x, c1y}, Vec2{c2x, c2y}, Vec2{x, y})
+	p.cur = Vec2{x, y}
+	return p
+}
+
+// ArcTo adds an elliptical arc from the current point to (x, y), as with SVG's arc command: the ellipse has radii rx
+// and ry and is rotated by rotation radians (clockwise on screen), and of the four arcs through the two points,
+// largeArc picks one spanning more than 180 degrees and sweep one going clockwise (on screen). Radii too small to
+// reach (x, y) are scaled up just enough, and zero radii give a straight line. The arc is stored as cubic Béziers
+// (which are within a tiny fraction of a pixel of it), so it transforms exactly with the rest of the path.
+func (p *Path) ArcTo(rx, ry, rotation float64, largeArc, sweep bool, x, y float64) *Path {
+	p.ensureOpen()
+	x0, y0 := p.cur.X, p.cur.Y
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		return p.LineTo(x, y)
+	}
+	if x0 == x && y0 == y {
+		return p
+	}
+
+	// Convert from endpoints to a center and angles, following the SVG implementation notes (F.6.5).
+	sin, cos := math.Sincos(rotation)
+	dx, dy := (x0-x)/2, (y0-y)/2
+	x1p, y1p := cos*dx+sin*dy, -sin*dx+cos*dy
+	if l := x1p*x1p/(rx*rx) + y1p*y1p/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	den := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coef := math.Sqrt(math.Max(0, num/den))
+	if largeArc == sweep {
+		coef = -coef
+	}
+	cxp, cyp := coef*rx*y1p/ry, -coef*ry*x1p/rx
+	cx, cy := cos*cxp-sin*cyp+(x0+x)/2, sin*cxp+cos*cyp+(y0+y)/2
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1p-cxp)/rx, (y1p-cyp)/ry)
+	delta := angle((x1p-cxp)/rx, (y1p-cyp)/ry, (-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	// Approximate each quarter turn (or less) with a cubic.
+	n := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+	// point returns the point at angle t on the ellipse, and the derivative there (scaled by k).
+	point := func(t float64) (Vec2, Vec2) {
+		st, ct := math.Sincos(t)
+		px, py := rx*ct, ry*st
+		tx, ty := -rx*st*k, ry*ct*k
+		return Vec2{cos*px - sin*py + cx, sin*px + cos*py + cy}, Vec2{cos*tx - sin*ty, sin*tx + cos*ty}
+	}
+	a, da := point(theta)
+	for i := 1; i <= n; i++ {
+		b, db := point(theta + step*float64(i))
+		if i == n {
+			// Land exactly on the requested end point.
+			b = Vec2{x, y}
+		}
+		p.CubicTo(a.X+da.X, a.Y+da.Y, b.X-db.X, b.Y-db.Y, b.X, b.Y)
+		a, da = b, db
+	}
+	return p
+}
+
+// Close closes the current subpath with a straight line back to its start. A following segment without a MoveTo
+// starts a new subpath there.
+func (p *Path) Close() *Path {
+	if p.open {
+		p.verbs = append(p.verbs, verbClose)
+		p.cur, p.open = p.start, false
+	}
+	return p
+}
+
+// Rect adds r as a closed subpath, clockwise (on screen) from r.Min.
+func (p *Path) Rect(r image.Rectangle) *Path {
+	x0, y0, x1, y1 := float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), float64(r.Max.Y)
+	return p.MoveTo(x0, y0).LineTo(x1, y0).LineTo(x1, y1).LineTo(x0, y1).Close()
+}
+
+// Ellipse adds the ellipse centered on (cx, cy) with radii rx and ry as a closed subpath, clockwise (on screen).
+func (p *Path) Ellipse(cx, cy, rx, ry float64) *Path {
+	return p.MoveTo(cx+rx, cy).ArcTo(rx, ry, 0, false, true, cx-rx, cy).ArcTo(rx, ry, 0, false, true, cx+rx, cy).
+		Close()
+}
+
+// Transform returns a copy of p with every point transformed by m.
+func (p *Path) Transform(m Affine) *Path {
+	t := &Path{verbs: append([]pathVerb(nil), p.verbs...), pts: make([]Vec2, len(p.pts)), open: p.open}
+	for i, pt := range p.pts {
+		t.pts[i].X, t.pts[i].Y = m.Apply(pt.X, pt.Y)
+	}
+	t.start.X, t.start.Y = m.Apply(p.start.X, p.start.Y)
+	t.cur.X, t.cur.Y = m.Apply(p.cur.X, p.cur.Y)
+	return t
+}
+
+// polyline is a flattened subpath.
+type polyline struct {
+	pts    []Vec2
+	closed bool
+}
+
+// flatten returns p's subpaths with curves approximated by straight lines.
+func (p *Path) flatten() []polyline {
+	var out []polyline
+	var cur *polyline
+	i := 0
+	last := func() Vec2 { return cur.pts[len(cur.pts)-1] }
+	// push adds v to the current subpath, unless it would be a segment of zero length.
+	push := func(v Vec2) {
+		if v != last() {
+			cur.pts = append(cur.pts, v)
+		}
+	}
+	for _, v := range p.verbs {
+		switch v {
+		case verbMoveTo:
+			out = append(out, polyline{pts: []Vec2{p.pts[i]}})
+			cur = &out[len(out)-1]
+			i++
+		case verbLineTo:
+			push(p.pts[i])
+			i++
+		case verbQuadTo:
+			p0, p1, p2 := last(), p.pts[i], p.pts[i+1]
+			dd := math.Hypot(p0.X-2*p1.X+p2.X, p0.Y-2*p1.Y+p2.Y)
+			n := int(math.Max(1, math.Ceil(math.Sqrt(dd/(4*pathTolerance)))))
+			for j := 1; j <= n; j++ {
+				t := float64(j) / float64(n)
+				u := 1 - t
+				push(Vec2{
+					u*u*p0.X + 2*u*t*p1.X + t*t*p2.X,
+					u*u*p0.Y + 2*u*t*p1.Y + t*t*p2.Y,
+				})
+			}
+			i += 2
+		case verbCubicTo:
+			p0, p1, p2, p3 := last(), p.pts[i], p.pts[i+1], p.pts[i+2]
+			dd := math.Max(math.Hypot(p0.X-2*p1.X+p2.X, p0.Y-2*p1.Y+p2.Y),
+				math.Hypot(p1.X-2*p2.X+p3.X, p1.Y-2*p2.Y+p3.Y))
+			n := int(math.Max(1, math.Ceil(math.Sqrt(0.75*dd/pathTolerance))))
+			for j := 1; j <= n; j++ {
+				t := float64(j) / float64(n)
+				u := 1 - t
+				push(Vec2{
+					u*u*u*p0.X + 3*u*u*t*p1.X + 3*u*t*t*p2.X + t*t*t*p3.X,
+					u*u*u*p0.Y + 3*u*u*t*p1.Y + 3*u*t*t*p2.Y + t*t*t*p3.Y,
+				})
+			}
+			i += 3
+		case verbClose:
+			cur.closed = true
+		}
+	}
+	return out
+}
+
+// FillPath fills p with the color provided by pixelBytes, with open subpaths implicitly closed. Pixels are filled if
+// their centers are inside p under rule; there is no anti-aliasing.
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) FillPath(p *Path, rule FillRule, pixelBytes ...uint8) {
+	fillPolygons(p.polygons(), rule, img.Rect, func(x0, y, x1 int) { img.DrawHLine(x0, y, x1, pixelBytes...) })
+}
+
+// FillPathWithPaint fills p like FillPath, but with its colors supplied by paint. Colors which aren't fully opaque
+// are blended over the existing pixels.
+func (img *Image) FillPathWithPaint(p *Path, rule FillRule, paint Paint) {
+	fillPolygons(p.polygons(), rule, img.Rect, func(x0, y, x1 int) { img.paintHLine(x0, y, x1, paint) })
+}
+
+// polygons returns p's flattened subpaths as polygons.
+func (p *Path) polygons() [][]Vec2 {
+	lines := p.flatten()
+	polys := make([][]Vec2, len(lines))
+	for i, l := range lines {
+		polys[i] = l.pts
+	}
+	return polys
+}
+
+// LineCap selects the shape of the ends of stroked open subpaths.
+type LineCap int
+
+const (
+	// CapButt ends strokes flat, exactly at their end points.
+	CapButt LineCap = iota
+	// CapRound ends strokes with semicircles.
+	CapRound
+	// CapSquare ends strokes flat, half the stroke width beyond their end points.
+	CapSquare
+)
+
+// LineJoin selects the shape of the corners of stroked paths.
+type LineJoin int
+
+const (
+	// JoinMiter extends the outer edges until they meet, unless that is further than MiterLimit allows, in which case
+	// the corner is beveled.
+	JoinMiter LineJoin = iota
+	// JoinRound rounds corners off with circular arcs.
+	JoinRound
+	// JoinBevel cuts corners off straight.
+	JoinBevel
+)
+
+// StrokeStyle describes how a path is stroked.
+type StrokeStyle struct {
+	// Width is the stroke's width in pixels.
+	Width float64
+	Cap   LineCap
+	Join  LineJoin
+	// MiterLimit limits the length of miter joins, as a multiple of Width, as in SVG. Values below 1 mean the SVG
+	// default of 4.
+	MiterLimit float64
+}
+
+// StrokePath strokes p with style, in the color provided by pixelBytes. Pixels are filled if their centers are
+// within the stroke; there is no anti-aliasing.
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) StrokePath(p *Path, style StrokeStyle, pixelBytes ...uint8) {
+	fillPolygons(p.strokePolygons(style), FillNonZero, img.Rect, func(x0, y, x1 int) {
+		img.DrawHLine(x0, y, x1, pixelBytes...)
+	})
+}
+
+// StrokePathWithPaint strokes p like StrokePath, but with its colors supplied by paint. Colors which aren't fully
+// opaque are blended over the existing pixels (once, even where parts of the stroke overlap).
+func (img *Image) StrokePathWithPaint(p *Path, style StrokeStyle, paint Paint) {
+	fillPolygons(p.strokePolygons(style), FillNonZero, img.Rect, func(x0, y, x1 int) {
+		img.paintHLine(x0, y, x1, paint)
+	})
+}
+
+// strokePolygons returns polygons which together (under FillNonZero) cover the stroke of p with style: one for each
+// segment, join and cap. They are all wound the same way, so they combine rather than cancel where they overlap.
+func (p *Path) strokePolygons(style StrokeStyle) [][]Vec2 {
+	hw := style.Width / 2
+	if hw <= 0 {
+		return nil
+	}
+	limit := style.MiterLimit
+	if limit < 1 {
+		limit = 4
+	}
+	var polys [][]Vec2
+	add := func(poly ...Vec2) {
+		// Orient every polygon the same way (positive area, clockwise on screen).
+		var area float64
+		for i, a := range poly {
+			b := poly[(i+1)%len(poly)]
+			area += a.X*b.Y - b.X*a.Y
+		}
+		if area < 0 {
+			for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+				poly[i], poly[j] = poly[j], poly[i]
+			}
+		}
+		polys = append(polys, poly)
+	}
+	// normal returns the unit normal of the segment from a to b, scaled to half the width.
+	normal := func(a, b Vec2) Vec2 {
+		l := math.Hypot(b.X-a.X, b.Y-a.Y)
+		return Vec2{-(b.Y - a.Y) / l * hw, (b.X - a.X) / l * hw}
+	}
+	circle := func(c Vec2) {
+		n := int(math.Max(8, math.Ceil(math.Pi*hw)))
+		poly := make([]Vec2, n)
+		for i := range poly {
+			s, co := math.Sincos(2 * math.Pi * float64(i) / float64(n))
+			poly[i] = Vec2{c.X + co*hw, c.Y + s*hw}
+		}
+		add(poly...)
+	}
+	join := func(prev, v, next Vec2) {
+		n0, n1 := normal(prev, v), normal(v, next)
+		// The outer side of the corner is opposite the turn.
+		cross := (v.X-prev.X)*(next.Y-v.Y) - (v.Y-prev.Y)*(next.X-v.X)
+		if cross == 0 {
+			return
+		}
+		if cross > 0 {
+			n0, n1 = Vec2{-n0.X, -n0.Y}, Vec2{-n1.X, -n1.Y}
+		}
+		a, b := Vec2{v.X + n0.X, v.Y + n0.Y}, Vec2{v.X + n1.X, v.Y + n1.Y}
+		switch style.Join {
+		case JoinRound:
+			circle(v)
+			return
+		case JoinMiter:
+			// The miter tip is along the bisector of the normals, at hw / cos(half the angle between them).
+			mx, my := n0.X+n1.X, n0.Y+n1.Y
+			ml := math.Hypot(mx, my)
+			if ml > 0 {
+				cosHalf := ml / (2 * hw)
+				if 1/cosHalf <= limit {
+					d := hw / cosHalf
+					add(v, a, Vec2{v.X + mx/ml*d, v.Y + my/ml*d}, b)
+					return
+				}
+			}
+		}
+		add(v, a, b)
+	}
+
+	for _, l := range p.flatten() {
+		pts := l.pts
+		if l.closed && len(pts) > 1 && pts[0] == pts[len(pts)-1] {
+			pts = pts[:len(pts)-1]
+		}
+		if len(pts) == 1 {
+			// A lone point is drawn as a dot, for round and square caps.
+			switch style.Cap {
+			case CapRound:
+				circle(pts[0])
+			case CapSquare:
+				c := pts[0]
+				add(Vec2{c.X - hw, c.Y - hw}, Vec2{c.X + hw, c.Y - hw}, Vec2{c.X + hw, c.Y + hw},
+					Vec2{c.X - hw, c.Y + hw})
+			}
+			continue
+		}
+		segs := len(pts) - 1
+		if l.closed {
+			segs = len(pts)
+		}
+		for i := 0; i < segs; i++ {
+			a, b := pts[i], pts[(i+1)%len(pts)]
+			n := normal(a, b)
+			add(Vec2{a.X + n.X, a.Y + n.Y}, Vec2{b.X + n.X, b.Y + n.Y}, Vec2{b.X - n.X, b.Y - n.Y},
+				Vec2{a.X - n.X, a.Y - n.Y})
+		}
+		for i := 1; i < len(pts)-1; i++ {
+			join(pts[i-1], pts[i], pts[i+1])
+		}
+		if l.closed {
+			if len(pts) > 2 {
+				join(pts[len(pts)-2], pts[len(pts)-1], pts[0])
+				join(pts[len(pts)-1], pts[0], pts[1])
+			}
+			continue
+		}
+		for _, end := range [2][2]Vec2{{pts[1], pts[0]}, {pts[len(pts)-2], pts[len(pts)-1]}} {
+			// end[1] is the end point, and end[0] the point before it.
+			from, e := end[0], end[1]
+			switch style.Cap {
+			case CapRound:
+				circle(e)
+			case CapSquare:
+				n := normal(from, e)
+				// The tangent is the normal turned back a quarter.
+				t := Vec2{n.Y, -n.X}
+				add(Vec2{e.X + n.X, e.Y + n.Y}, Vec2{e.X + n.X + t.X, e.Y + n.Y + t.Y},
+					Vec2{e.X - n.X + t.X, e.Y - n.Y + t.Y}, Vec2{e.X - n.X, e.Y - n.Y})
+			}
+		}
+	}
+	return polys
+}
+
+// SVGData returns p as SVG path data (as for the d attribute of a path element), using absolute M, L, Q, C and Z
+// commands. ParseSVGData reverses it.
+func (p *Path) SVGData() string {
+	var b strings.Builder
+	num := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	i := 0
+	for _, v := range p.verbs {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		n := 0
+		switch v {
+		case verbMoveTo:
+			b.WriteByte('M')
+			n = 1
+		case verbLineTo:
+			b.WriteByte('L')
+			n = 1
+		case verbQuadTo:
+			b.WriteByte('Q')
+			n = 2
+		case verbCubicTo:
+			b.WriteByte('C')
+			n = 3
+		case verbClose:
+			b.WriteByte('Z')
+		}
+		for j, pt := range p.pts[i : i+n] {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(num(pt.X))
+			b.WriteByte(',')
+			b.WriteString(num(pt.Y))
+		}
+		i += n
+	}
+	return b.String()
+}
+
+// ParseSVGData parses SVG path data made up of absolute M, L, Q, C and Z commands, as written by SVGData.
+// Other commands (relative ones, arcs etc.) are not supported.
+func ParseSVGData(d string) (*Path, error) {
+	p := &Path{}
+	fields := strings.FieldsFunc(d, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' || r == '\n' })
+	var cmd byte
+	for i := 0; i < len(fields); {
+		f := fields[i]
+		if c := f[0]; (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			cmd = c
+			if f = f[1:]; f == "" {
+				i++
+			} else {
+				fields[i] = f
+			}
+			if cmd == 'Z' {
+				p.Close()
+				continue
+			}
+		}
+		var n int
+		switch cmd {
+		case 'M', 'L':
+			n = 2
+		case 'Q':
+			n = 4
+		case 'C':
+			n = 6
+		default:
+			return nil, fmt.Errorf("unsupported path command %q", cmd)
+		}
+		if i+n > len(fields) {
+			return nil, fmt.Errorf("path command %c needs %d numbers", cmd, n)
+		}
+		v := make([]float64, n)
+		for j := range v {
+			var err error
+			if v[j], err = strconv.ParseFloat(fields[i+j], 64); err != nil {
+				return nil, err
+			}
+		}
+		i += n
+		switch cmd {
+		case 'M':
+			p.MoveTo(v[0], v[1])
+			// As in SVG, further coordinate pairs after a move are lines.
+			cmd = 'L'
+		case 'L':
+			p.LineTo(v[0], v[1])
+		case 'Q':
+			p.QuadTo(v[0], v[1], v[2], v[3])
+		case 'C':
+			p.CubicTo(v[0], v[1], v[2], v[3], v[4], v[5])
+		}
+	}
+	return p, nil
+}
+
+// MarshalJSON encodes p as a string of SVG path data (see SVGData).
+func (p *Path) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.SVGData())
+}
+
+// UnmarshalJSON decodes p from a string of SVG path data (see ParseSVGData).
+func (p *Path) UnmarshalJSON(b []byte) error {
+	var d string
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	parsed, err := ParseSVGData(d)
+	if err != nil {
+		return err
+	}
+	*p = *parsed
+	return nil
+}
@@ -0,0 +1,174 @@
+package graphics
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ImagePattern is a Paint which tiles an image across the plane, like a texture.
+type ImagePattern struct {
+	img *Image
+	// offset is where the image's top-left corner is placed (before tiling).
+	offset    image.Point
+	transform Affine
+	// inverse maps destination coordinates back to pattern coordinates, if there is a transformation.
+	inverse *Affine
+	// sampler interpolates the image, if there is a transformation and interpolation other than nearest.
+	sampler Sampler
+}
+
+// NewImagePattern returns an ImagePattern tiling img, with its top-left corner (img.Rect.Min) placed at offset.
+func NewImagePattern(img *Image, offset image.Point) *ImagePattern {
+	return &ImagePattern{img: img, offset: offset, transform: IdentityAffine()}
+}
+
+// SetTransform sets a transformation applied to the pattern (after placing it at its offset), such as to scale or
+// rotate it, with interp used to interpolate between its pixels. An error is returned if m is not invertible.
+// Interpolation other than InterpNearest is only available for RGB and gray formats; others always use the nearest
+// pixel.
+func (p *ImagePattern) SetTransform(m Affine, interp Interpolation) error {
+	inv, ok := m.Invert()
+	if !ok {
+		return errors.New("pattern transform is not invertible")
+	}
+	p.transform, p.inverse = m, &inv
+	p.sampler = nil
+	if interp != InterpNearest && (p.img.isRGB() || p.img.isGray()) {
+		p.sampler = NewSampler(p.img, interp, EdgeWrap)
+	}
+	return nil
+}
+
+// Transform returns the pattern's transformation (the identity if none has been set).
+func (p *ImagePattern) Transform() Affine {
+	return p.transform
+}
+
+// ColorAt returns the color at pixel (x, y). A pattern of an empty image is transparent.
+func (p *ImagePattern) ColorAt(x, y int) color.NRGBA64 {
+	r := p.img.Rect
+	if r.Empty() {
+		return color.NRGBA64{}
+	}
+	if p.inverse == nil {
+		px, _ := edgeCoord(x-p.offset.X+r.Min.X, r.Min.X, r.Max.X, EdgeWrap)
+		py, _ := edgeCoord(y-p.offset.Y+r.Min.Y, r.Min.Y, r.Max.Y, EdgeWrap)
+		return straightToNRGBA64(p.img.straightAt(p.img.offset(px, py), px, py))
+	}
+
+	// Map the pixel's center back into the pattern.
+	u, v := p.inverse.Apply(float64(x)+0.5, float64(y)+0.5)
+	return p.colorAt(u-float64(p.offset.X), v-float64(p.offset.Y))
+}
+
+// colorAt returns the color at (u, v) in the image, tiled, with (0, 0) its top-left corner and pixel centers at
+// half-integers, using the sampler if there is one. It is transparent if the image is empty.
+func (p *ImagePattern) colorAt(u, v float64) color.NRGBA64 {
+	r := p.img.Rect
+	if r.Empty() {
+		return color.NRGBA64{}
+	}
+	u, v = u+float64(r.Min.X), v+float64(r.Min.Y)
+	if p.sampler == nil {
+		px, _ := edgeCoord(int(math.Floor(u)), r.Min.X, r.Max.X, EdgeWrap)
+		py, _ := edgeCoord(int(math.Floor(v)), r.Min.Y, r.Max.Y, EdgeWrap)
+		return straightToNRGBA64(p.img.straightAt(p.img.offset(px, py), px, py))
+	}
+	// Pixels have at most 4 channels. Sampling onto the stack keeps ColorAt safe for concurrent use.
+	var px [4]float64
+	p.sampler.Sample(u-0.5, v-0.5, px[:])
+	max := p.img.maxValue()
+	if p.img.isGray() {
+		g := clamp01(px[0] / max)
+		return straightToNRGBA64([4]float64{g, g, g, 1})
+	}
+	c := [4]float64{clamp01(px[0] / max), clamp01(px[1] / max), clamp01(px[2] / max), clamp01(px[3] / max)}
+	if p.img.premul && c[3] > 0 {
+		c[0], c[1], c[2] = clamp01(c[0]/c[3]), clamp01(c[1]/c[3]), clamp01(c[2]/c[3])
+	}
+	return straightToNRGBA64(c)
+}
+
+// straightToNRGBA64 converts a straight RGBA color with channels in [0,1] to a color.NRGBA64.
+func straightToNRGBA64(c [4]float64) color.NRGBA64 {
+	return color.NRGBA64{
+		R: uint16(c[0]*65535 + 0.5), G: uint16(c[1]*65535 + 0.5),
+		B: uint16(c[2]*65535 + 0.5), A: uint16(c[3]*65535 + 0.5),
+	}
+}
+
+// HatchStyle selects the pattern of a HatchPaint.
+type HatchStyle int
+
+const (
+	// HatchDiagonal is lines rising to the right (/).
+	HatchDiagonal HatchStyle = iota
+	// HatchBackDiagonal is lines falling to the right (\).
+	HatchBackDiagonal
+	// HatchHorizontal is horizontal lines.
+	HatchHorizontal
+	// HatchVertical is vertical lines.
+	HatchVertical
+	// HatchCross is horizontal and vertical lines.
+	HatchCross
+	// HatchDiagonalCross is lines in both diagonal directions.
+	HatchDiagonalCross
+	// HatchDots is a grid of square dots.
+	HatchDots
+)
+
+// HatchPaint is a Paint of a procedural hatch pattern, such as for distinguishing regions where colors can't be relied
+// on (as in grayscale prints). The pattern is aligned to the origin, so adjacent shapes' hatching lines up.
+type HatchPaint struct {
+	Style HatchStyle
+	// Foreground is the color of the lines or dots, and Background that of the rest. A transparent Background (the
+	// zero value) leaves what is beneath showing through.
+	Foreground, Background color.NRGBA64
+	// Spacing is the distance in pixels between successive lines or dots (measured along the axes for diagonal
+	// lines), and Width their thickness. Width should be less than Spacing.
+	Spacing, Width int
+}
+
+// NewHatchPaint returns a HatchPaint of style, with lines or dots of color fg, 1 pixel wide, every spacing pixels,
+// over bg (which may be nil for transparent).
+func NewHatchPaint(style HatchStyle, fg, bg color.Color, spacing int) *HatchPaint {
+	h := &HatchPaint{Style: style, Spacing: spacing, Width: 1}
+	h.Foreground = color.NRGBA64Model.Convert(fg).(color.NRGBA64)
+	if bg != nil {
+		h.Background = color.NRGBA64Model.Convert(bg).(color.NRGBA64)
+	}
+	return h
+}
+
+// ColorAt returns the color at pixel (x, y).
+func (h *HatchPaint) ColorAt(x, y int) color.NRGBA64 {
+	s := h.Spacing
+	if s < 1 {
+		return h.Foreground
+	}
+	// on returns whether v (a coordinate, or combination of them) falls on a line.
+	on := func(v int) bool { return (v%s+s)%s < h.Width }
+	var hit bool
+	switch h.Style {
+	case HatchDiagonal:
+		hit = on(x + y)
+	case HatchBackDiagonal:
+		hit = on(x - y)
+	case HatchHorizontal:
+		hit = on(y)
+	case HatchVertical:
+		hit = on(x)
+	case HatchCross:
+		hit = on(x) || on(y)
+	case HatchDiagonalCross:
+		hit = on(x+y) || on(x-y)
+	case HatchDots:
+		hit = on(x) && on(y)
+	}
+	if hit {
+		return h.Foreground
+	}
+	return h.Background
+}
@@ -0,0 +1,477 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"sync"
+)
+
+// nrgbaAt returns the pixel at offset o (and coordinates (x, y)) as straight (non-premultiplied) 8-bit RGBA. RGB and
+// gray formats are read directly from Pix; others go through At.
+func (img *Image) nrgbaAt(o, x, y int) color.NRGBA {
+	switch {
+	case img.isRGB():
+		// The high byte of 16-bit channels is the first.
+		c := color.NRGBA{img.Pix[o], img.Pix[o+img.depth], img.Pix[o+2*img.depth], img.Pix[o+3*img.depth]}
+		if img.premul && c.A != 255 {
+			if c.A == 0 {
+				return color.NRGBA{}
+			}
+			c.R = uint8((uint32(c.R)*255 + uint32(c.A)/2) / uint32(c.A))
+			c.G = uint8((uint32(c.G)*255 + uint32(c.A)/2) / uint32(c.A))
+			c.B = uint8((uint32(c.B)*255 + uint32(c.A)/2) / uint32(c.A))
+		}
+		return c
+	case img.isGray():
+		return color.NRGBA{img.Pix[o], img.Pix[o], img.Pix[o], 255}
+	}
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
+
+// colorCount is a distinct color and the number of pixels having it.
+type colorCount struct {
+	c [4]uint8
+	n int
+}
+
+// colorCounts returns every distinct color (as straight 8-bit RGBA, with all fully transparent colors merged) in img,
+// with its pixel count.
+func colorCounts(img *Image) []colorCount {
+	counts := make(map[color.NRGBA]int)
+	var mu sync.Mutex
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		local := make(map[color.NRGBA]int)
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o = x+1, o+img.bpp {
+				c := img.nrgbaAt(o, x, y)
+				if c.A == 0 {
+					c = color.NRGBA{}
+				}
+				local[c]++
+			}
+		}
+		mu.Lock()
+		for c, n := range local {
+			counts[c] += n
+		}
+		mu.Unlock()
+	})
+	cs := make([]colorCount, 0, len(counts))
+	for c, n := range counts {
+		cs = append(cs, colorCount{c: [4]uint8{c.R, c.G, c.B, c.A}, n: n})
+	}
+	// Map iteration order is random; sorting keeps the quantizers deterministic.
+	sort.Slice(cs, func(i, j int) bool {
+		a, b := cs[i].c, cs[j].c
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return cs
+}
+
+// imageFor returns m as an *Image, wrapping it if it's a type NewImage supports and otherwise copying it to an
+// image.NRGBA.
+func imageFor(m image.Image) *Image {
+	if img, ok := m.(*Image); ok {
+		return img
+	}
+	if imgr, ok := m.(Imager); ok {
+		if img, err := NewImage(imgr); err == nil {
+			return img
+		}
+	}
+	n := image.NewNRGBA(m.Bounds())
+	draw.Draw(n, n.Rect, m, m.Bounds().Min, draw.Src)
+	img, _ := NewImage(n)
+	return img
+}
+
+// MedianCutPalette returns a palette of at most n colors for img, chosen by median cut: starting with a box around all
+// of img's colors (in RGBA space), the box with the widest spread (weighted by pixel count) is repeatedly split at
+// the median of its widest channel, and each final box contributes the mean of its colors. If img has n or fewer
+// distinct colors, they are returned exactly.
+func MedianCutPalette(img *Image, n int) color.Palette {
+	if n < 1 {
+		return color.Palette{}
+	}
+	cs := colorCounts(img)
+	if len(cs) <= n {
+		return paletteOf(cs)
+	}
+	type box struct {
+		cs []colorCount
+		// axis is the channel with the widest range, and score is that range times the pixel count.
+		axis  int
+		score int
+	}
+	measure := func(cs []colorCount) box {
+		b := box{cs: cs}
+		lo, hi := [4]uint8{255, 255, 255, 255}, [4]uint8{}
+		count := 0
+		for _, c := range cs {
+			for k, v := range c.c {
+				if v < lo[k] {
+					lo[k] = v
+				}
+				if v > hi[k] {
+					hi[k] = v
+				}
+			}
+			count += c.n
+		}
+		for k := range lo {
+			if r := int(hi[k]) - int(lo[k]); r*count > b.score {
+				b.axis, b.score = k, r*count
+			}
+		}
+		return b
+	}
+
+	boxes := []box{measure(cs)}
+	for len(boxes) < n {
+		best := -1
+		for i, b := range boxes {
+			if len(b.cs) > 1 && (best < 0 || b.score > boxes[best].score) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		b := boxes[best]
+		axis := b.axis
+		sort.SliceStable(b.cs, func(i, j int) bool { return b.cs[i].c[axis] < b.cs[j].c[axis] })
+		total := 0
+		for _, c := range b.cs {
+			total += c.n
+		}
+		// Split at the weighted median, keeping at least one color on each side.
+		split, cum := 1, 0
+		for i, c := range b.cs[:len(b.cs)-1] {
+			cum += c.n
+			if cum*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[best] = measure(b.cs[:split])
+		boxes = append(boxes, measure(b.cs[split:]))
+	}
+
+	p := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		p[i] = meanColor(b.cs)
+	}
+	return p
+}
+
+// meanColor returns the pixel count weighted mean of cs.
+func meanColor(cs []colorCount) color.NRGBA {
+	var sum [4]int
+	total := 0
+	for _, c := range cs {
+		for k, v := range c.c {
+			sum[k] += int(v) * c.n
+		}
+		total += c.n
+	}
+	if total == 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{
+		R: uint8((sum[0] + total/2) / total), G: uint8((sum[1] + total/2) / total),
+		B: uint8((sum[2] + total/2) / total), A: uint8((sum[3] + total/2) / total),
+	}
+}
+
+// paletteOf returns the colors of cs as a palette.
+func paletteOf(cs []colorCount) color.Palette {
+	p := make(color.Palette, len(cs))
+	for i, c := range cs {
+		p[i] = color.NRGBA{c.c[0], c.c[1], c.c[2], c.c[3]}
+	}
+	return p
+}
+
+// octreeNode is a node of the octree used by OctreePalette. Each level splits on one more bit of each of R, G and B.
+type octreeNode struct {
+	children [8]*octreeNode
+	// sum and n accumulate the colors (RGBA) and pixel count of the node's subtree once it is a leaf.
+	sum  [4]int
+	n    int
+	leaf bool
+}
+
+// OctreePalette returns a palette of at most n colors for img, chosen by octree quantization: img's colors are
+// inserted into an 8-level octree on their RGB bits, and then the least populous deepest nodes are merged into their
+// parents until at most n leaves remain, each contributing the mean of its colors. It is usually faster than median
+// cut, though its palettes tend to be a little less faithful. If img has n or fewer distinct colors, they are
+// returned exactly.
+func OctreePalette(img *Image, n int) color.Palette {
+	if n < 1 {
+		return color.Palette{}
+	}
+	cs := colorCounts(img)
+	if len(cs) <= n {
+		return paletteOf(cs)
+	}
+
+	root := &octreeNode{}
+	// levels[d] holds the interior nodes at depth d, which are the merge candidates.
+	var levels [8][]*octreeNode
+	levels[0] = []*octreeNode{root}
+	leaves := 0
+	for _, c := range cs {
+		node := root
+		for d := 0; d < 8; d++ {
+			shift := 7 - d
+			i := int(c.c[0]>>shift&1)<<2 | int(c.c[1]>>shift&1)<<1 | int(c.c[2]>>shift&1)
+			if node.children[i] == nil {
+				node.children[i] = &octreeNode{}
+				if d < 7 {
+					levels[d+1] = append(levels[d+1], node.children[i])
+				} else {
+					node.children[i].leaf = true
+					leaves++
+				}
+			}
+			node = node.children[i]
+		}
+		for k, v := range c.c {
+			node.sum[k] += int(v) * c.n
+		}
+		node.n += c.n
+	}
+
+	// Merge from the deepest level up, least populous first, until there are few enough leaves.
+	var count func(*octreeNode) int
+	count = func(node *octreeNode) int {
+		if node.leaf {
+			return node.n
+		}
+		t := 0
+		for _, ch := range node.children {
+			if ch != nil {
+				t += count(ch)
+			}
+		}
+		return t
+	}
+	for d := 7; d >= 0 && leaves > n; d-- {
+		nodes := levels[d]
+		counts := make([]int, len(nodes))
+		for i, node := range nodes {
+			counts[i] = count(node)
+		}
+		idx := make([]int, len(nodes))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(a, b int) bool { return counts[idx[a]] < counts[idx[b]] })
+		for _, i := range idx {
+			if leaves <= n {
+				break
+			}
+			node := nodes[i]
+			merged := 0
+			for j, ch := range node.children {
+				if ch == nil {
+					continue
+				}
+				for k := range node.sum {
+					node.sum[k] += ch.sum[k]
+				}
+				node.n += ch.n
+				node.children[j] = nil
+				merged++
+			}
+			node.leaf = true
+			leaves -= merged - 1
+		}
+	}
+
+	p := make(color.Palette, 0, leaves)
+	var collect func(*octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			if node.n > 0 {
+				p = append(p, color.NRGBA{
+					R: uint8((node.sum[0] + node.n/2) / node.n), G: uint8((node.sum[1] + node.n/2) / node.n),
+					B: uint8((node.sum[2] + node.n/2) / node.n), A: uint8((node.sum[3] + node.n/2) / node.n),
+				})
+			}
+			return
+		}
+		for _, ch := range node.children {
+			if ch != nil {
+				collect(ch)
+			}
+		}
+	}
+	collect(root)
+	return p
+}
+
+// KMeansRefine returns p refined by up to iterations rounds of k-means clustering of img's colors (in RGBA space):
+// each color is assigned to its nearest palette entry, and each entry is moved to the mean of the colors assigned to
+// it. Refinement stops early once an iteration changes nothing. Entries no colors are assigned to are left as they
+// are. The result has the same number of colors as p, and p itself is unchanged.
+func KMeansRefine(img *Image, p color.Palette, iterations int) color.Palette {
+	return kMeansRefine(colorCounts(img), p, iterations)
+}
+
+func kMeansRefine(cs []colorCount, p color.Palette, iterations int) color.Palette {
+	centers := nrgbaPalette(p)
+	assign := make([]int, len(cs))
+	for it := 0; it < iterations; it++ {
+		sums := make([][4]int, len(centers))
+		totals := make([]int, len(centers))
+		for i, c := range cs {
+			k := nearestNRGBA(centers, c.c)
+			assign[i] = k
+			for j, v := range c.c {
+				sums[k][j] += int(v) * c.n
+			}
+			totals[k] += c.n
+		}
+		changed := false
+		for k := range centers {
+			if totals[k] == 0 {
+				continue
+			}
+			t := totals[k]
+			nc := [4]uint8{}
+			for j := range nc {
+				nc[j] = uint8((sums[k][j] + t/2) / t)
+			}
+			if nc != centers[k] {
+				centers[k] = nc
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	out := make(color.Palette, len(centers))
+	for i, c := range centers {
+		out[i] = color.NRGBA{c[0], c[1], c[2], c[3]}
+	}
+	return out
+}
+
+// nrgbaPalette converts p to straight 8-bit RGBA arrays.
+func nrgbaPalette(p color.Palette) [][4]uint8 {
+	out := make([][4]uint8, len(p))
+	for i, c := range p {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		out[i] = [4]uint8{n.R, n.G, n.B, n.A}
+	}
+	return out
+}
+
+// nearestNRGBA returns the index of the entry of p nearest to c (by squared Euclidean distance in RGBA).
+func nearestNRGBA(p [][4]uint8, c [4]uint8) int {
+	best, bestD := 0, -1
+	for i, e := range p {
+		d := 0
+		for k := range e {
+			v := int(e[k]) - int(c[k])
+			d += v * v
+		}
+		if bestD < 0 || d < bestD {
+			best, bestD = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Quantize returns an image.Paletted, with img's bounds and palette p, in which each pixel is the entry of p nearest
+// to the corresponding pixel of img (in straight RGBA). p can have at most 256 colors, as image.Paletted has a byte
+// per pixel. It doesn't dither; see Dither for that. Rows are processed in parallel.
+func Quantize(img *Image, p color.Palette) (*image.Paletted, error) {
+	if err := checkPaletteSize(p); err != nil {
+		return nil, err
+	}
+	dst := image.NewPaletted(img.Rect, p)
+	if len(p) == 0 {
+		return dst, nil
+	}
+	pal := nrgbaPalette(p)
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		// Images usually have far fewer distinct colors than pixels, so remember the answers.
+		cache := make(map[color.NRGBA]uint8)
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			do := dst.PixOffset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x, o, do = x+1, o+img.bpp, do+1 {
+				c := img.nrgbaAt(o, x, y)
+				i, ok := cache[c]
+				if !ok {
+					i = uint8(nearestNRGBA(pal, [4]uint8{c.R, c.G, c.B, c.A}))
+					cache[c] = i
+				}
+				dst.Pix[do] = i
+			}
+		}
+	})
+	return dst, nil
+}
+
+// checkPaletteSize returns an error if p has more colors than an image.Paletted can index.
+func checkPaletteSize(p color.Palette) error {
+	if len(p) > 256 {
+		return fmt.Errorf("palette has %d colors; at most 256 are supported", len(p))
+	}
+	return nil
+}
+
+// QuantizeMethod selects the algorithm a Quantizer uses to choose its palette.
+type QuantizeMethod int
+
+const (
+	// QuantizeMedianCut uses MedianCutPalette.
+	QuantizeMedianCut QuantizeMethod = iota
+	// QuantizeOctree uses OctreePalette.
+	QuantizeOctree
+)
+
+// Quantizer implements draw.Quantizer (as used by image/gif's Options, for example), choosing palettes with Method
+// and then refining them with KMeansIterations rounds of KMeansRefine (0 for none).
+type Quantizer struct {
+	Method           QuantizeMethod
+	KMeansIterations int
+}
+
+// Quantize appends up to cap(p) - len(p) colors chosen for m to p and returns the result, as draw.Quantizer requires.
+// Existing colors of p are kept, but the new ones are chosen without regard to them.
+func (q Quantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := cap(p) - len(p)
+	if n <= 0 {
+		return p
+	}
+	img := imageFor(m)
+	var chosen color.Palette
+	if q.Method == QuantizeOctree {
+		chosen = OctreePalette(img, n)
+	} else {
+		chosen = MedianCutPalette(img, n)
+	}
+	if q.KMeansIterations > 0 {
+		chosen = KMeansRefine(img, chosen, q.KMeansIterations)
+	}
+	return append(p, chosen...)
+}
+
+var _ draw.Quantizer = Quantizer{}
@@ -0,0 +1,445 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Canvas is the set of drawing methods shared by Image and Recorder, so that drawing code can target either.
+type Canvas interface {
+	SetPixel(x, y int, pixelBytes ...uint8)
+	DrawHLine(x0, y0, x1 int, pixelBytes ...uint8)
+	DrawVLine(x0, y0, y1 int, pixelBytes ...uint8)
+	DrawCircleBorder(cx, cy, rad int, pixelBytes ...uint8)
+	DrawFilledCircle(cx, cy, rad int, pixelBytes ...uint8)
+	DrawFilledRect(r image.Rectangle, pixelBytes ...uint8)
+	DrawFilledPolygon(pts []Vec2, rule FillRule, pixelBytes ...uint8)
+	FillPath(p *Path, rule FillRule, pixelBytes ...uint8)
+	StrokePath(p *Path, style StrokeStyle, pixelBytes ...uint8)
+	PlaceAtPoint(src *image.RGBA, pt image.Point)
+}
+
+var (
+	_ Canvas = (*Image)(nil)
+	_ Canvas = (*Recorder)(nil)
+)
+
+// OpKind identifies the drawing method an Op records.
+type OpKind int
+
+const (
+	// OpSetPixel records SetPixel. Args are x, y.
+	OpSetPixel OpKind = iota
+	// OpHLine records DrawHLine. Args are x0, y0, x1.
+	OpHLine
+	// OpVLine records DrawVLine. Args are x0, y0, y1.
+	OpVLine
+	// OpCircleBorder records DrawCircleBorder. Args are cx, cy, rad.
+	OpCircleBorder
+	// OpFilledCircle records DrawFilledCircle. Args are cx, cy, rad.
+	OpFilledCircle
+	// OpFilledRect records DrawFilledRect. Args are r.Min.X, r.Min.Y, r.Max.X, r.Max.Y.
+	OpFilledRect
+	// OpFilledPolygon records DrawFilledPolygon, with Points and Rule.
+	OpFilledPolygon
+	// OpFillPath records FillPath, with Path and Rule.
+	OpFillPath
+	// OpStrokePath records StrokePath, with Path and Stroke.
+	OpStrokePath
+	// OpBlit records PlaceAtPoint, with Image. Args are pt.X, pt.Y.
+	OpBlit
+)
+
+var opKindNames = [...]string{
+	"setPixel", "hLine", "vLine", "circleBorder", "filledCircle", "filledRect", "filledPolygon", "fillPath",
+	"strokePath", "blit",
+}
+
+func (k OpKind) String() string {
+	if k < 0 || int(k) >= len(opKindNames) {
+		return "OpKind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return opKindNames[k]
+}
+
+// MarshalText encodes k as its name, such as "filledRect".
+func (k OpKind) MarshalText() ([]byte, error) {
+	if k < 0 || int(k) >= len(opKindNames) {
+		return nil, fmt.Errorf("unknown op kind %d", int(k))
+	}
+	return []byte(opKindNames[k]), nil
+}
+
+// UnmarshalText decodes k from its name.
+func (k *OpKind) UnmarshalText(b []byte) error {
+	for i, name := range opKindNames {
+		if name == string(b) {
+			*k = OpKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown op kind %q", b)
+}
+
+// Op is a single recorded drawing operation. Which fields are used depends on Kind.
+type Op struct {
+	Kind   OpKind
+	Args   []int
+	Points []Vec2
+	Path   *Path
+	Rule   FillRule
+	Stroke StrokeStyle
+	// Color holds the pixelBytes the operation was drawn with.
+	Color []uint8
+	Image *image.RGBA
+}
+
+// opJSON is the JSON form of an Op: Color is a list of numbers rather than base64, and Image is PNG encoded.
+type opJSON struct {
+	Kind   OpKind       `json:"kind"`
+	Args   []int        `json:"args,omitempty"`
+	Points []Vec2       `json:"points,omitempty"`
+	Path   *Path        `json:"path,omitempty"`
+	Rule   FillRule     `json:"rule,omitempty"`
+	Stroke *StrokeStyle `json:"stroke,omitempty"`
+	Color  []int        `json:"color,omitempty"`
+	Image  []byte       `json:"image,omitempty"`
+}
+
+// MarshalJSON encodes op as a JSON object, with any image as PNG (in base64).
+func (op Op) MarshalJSON() ([]byte, error) {
+	j := opJSON{Kind: op.Kind, Args: op.Args, Points: op.Points, Path: op.Path, Rule: op.Rule}
+	if op.Kind == OpStrokePath {
+		j.Stroke = &op.Stroke
+	}
+	for _, c := range op.Color {
+		j.Color = append(j.Color, int(c))
+	}
+	if op.Image != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, op.Image); err != nil {
+			return nil, err
+		}
+		j.Image = buf.Bytes()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes op from the form written by MarshalJSON.
+func (op *Op) UnmarshalJSON(b []byte) error {
+	var j opJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*op = Op{Kind: j.Kind, Args: j.Args, Points: j.Points, Path: j.Path, Rule: j.Rule}
+	if j.Stroke != nil {
+		op.Stroke = *j.Stroke
+	}
+	for _, c := range j.Color {
+		if c < 0 || c > 255 {
+			return fmt.Errorf("color byte %d out of range", c)
+		}
+		op.Color = append(op.Color, uint8(c))
+	}
+	if j.Image != nil {
+		m, err := png.Decode(bytes.NewReader(j.Image))
+		if err != nil {
+			return err
+		}
+		op.Image = image.NewRGBA(image.Rect(0, 0, m.Bounds().Dx(), m.Bounds().Dy()))
+		draw.Draw(op.Image, op.Image.Rect, m, m.Bounds().Min, draw.Src)
+	}
+	return op.validate()
+}
+
+// validate returns an error if op is of an unknown kind or lacks the fields its kind uses.
+func (op *Op) validate() error {
+	if op.Kind < 0 || int(op.Kind) >= len(opKindNames) {
+		return fmt.Errorf("unknown op kind %d", int(op.Kind))
+	}
+	if want := opArgs(op.Kind); len(op.Args) != want {
+		return fmt.Errorf("%v op needs %d args, found %d", op.Kind, want, len(op.Args))
+	}
+	if (op.Kind == OpFillPath || op.Kind == OpStrokePath) && op.Path == nil {
+		return fmt.Errorf("%v op has no path", op.Kind)
+	}
+	if op.Kind == OpBlit && op.Image == nil {
+		return fmt.Errorf("%v op has no image", op.Kind)
+	}
+	return nil
+}
+
+// opArgs returns the number of Args an op of kind k has.
+func opArgs(k OpKind) int {
+	switch k {
+	case OpSetPixel, OpBlit:
+		return 2
+	case OpHLine, OpVLine, OpCircleBorder, OpFilledCircle:
+		return 3
+	case OpFilledRect:
+		return 4
+	}
+	return 0
+}
+
+// Recorder is a Canvas which records the operations drawn on it rather than rasterizing them, so that they can be
+// replayed onto any Image (at any scale, so that an overlay can be drawn crisply at several sizes rather than
+// resampled), saved as JSON, or written as SVG. The zero value is an empty Recorder ready to use.
+//
+// Recorded slices, paths and images are copied, so callers may reuse theirs.
+type Recorder struct {
+	Ops []Op
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Reset discards all recorded operations.
+func (rec *Recorder) Reset() {
+	rec.Ops = rec.Ops[:0]
+}
+
+func (rec *Recorder) record(kind OpKind, pixelBytes []uint8, args ...int) *Op {
+	rec.Ops = append(rec.Ops, Op{Kind: kind, Args: args, Color: append([]uint8(nil), pixelBytes...)})
+	return &rec.Ops[len(rec.Ops)-1]
+}
+
+// SetPixel records Image.SetPixel.
+func (rec *Recorder) SetPixel(x, y int, pixelBytes ...uint8) {
+	rec.record(OpSetPixel, pixelBytes, x, y)
+}
+
+// DrawHLine records Image.DrawHLine.
+func (rec *Recorder) DrawHLine(x0, y0, x1 int, pixelBytes ...uint8) {
+	rec.record(OpHLine, pixelBytes, x0, y0, x1)
+}
+
+// DrawVLine records Image.DrawVLine.
+func (rec *Recorder) DrawVLine(x0, y0, y1 int, pixelBytes ...uint8) {
+	rec.record(OpVLine, pixelBytes, x0, y0, y1)
+}
+
+// DrawCircleBorder records Image.DrawCircleBorder.
+func (rec *Recorder) DrawCircleBorder(cx, cy, rad int, pixelBytes ...uint8) {
+	rec.record(OpCircleBorder, pixelBytes, cx, cy, rad)
+}
+
+// DrawFilledCircle records Image.DrawFilledCircle.
+func (rec *Recorder) DrawFilledCircle(cx, cy, rad int, pixelBytes ...uint8) {
+	rec.record(OpFilledCircle, pixelBytes, cx, cy, rad)
+}
+
+// DrawFilledRect records Image.DrawFilledRect.
+func (rec *Recorder) DrawFilledRect(r image.Rectangle, pixelBytes ...uint8) {
+	rec.record(OpFilledRect, pixelBytes, r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+}
+
+// DrawFilledPolygon records Image.DrawFilledPolygon.
+func (rec *Recorder) DrawFilledPolygon(pts []Vec2, rule FillRule, pixelBytes ...uint8) {
+	op := rec.record(OpFilledPolygon, pixelBytes)
+	op.Points, op.Rule = append([]Vec2(nil), pts...), rule
+}
+
+// FillPath records Image.FillPath.
+func (rec *Recorder) FillPath(p *Path, rule FillRule, pixelBytes ...uint8) {
+	op := rec.record(OpFillPath, pixelBytes)
+	op.Path, op.Rule = p.Transform(IdentityAffine()), rule
+}
+
+// StrokePath records Image.StrokePath.
+func (rec *Recorder) StrokePath(p *Path, style StrokeStyle, pixelBytes ...uint8) {
+	op := rec.record(OpStrokePath, pixelBytes)
+	op.Path, op.Stroke = p.Transform(IdentityAffine()), style
+}
+
+// PlaceAtPoint records Image.PlaceAtPoint.
+func (rec *Recorder) PlaceAtPoint(src *image.RGBA, pt image.Point) {
+	op := rec.record(OpBlit, nil, pt.X, pt.Y)
+	op.Image = image.NewRGBA(image.Rect(0, 0, src.Rect.Dx(), src.Rect.Dy()))
+	draw.Draw(op.Image, op.Image.Rect, src, src.Rect.Min, draw.Src)
+}
+
+// Replay draws the recorded operations onto dst, with every coordinate multiplied by scale. At scale 1 each operation
+// is drawn exactly as it would have been on dst directly. At other scales shapes are redrawn at the new size rather
+// than scaled afterward: pixels and lines become rectangles scale pixels wide, circles become (stroked or filled)
+// paths of the scaled radius, polygon and path coordinates and stroke widths are scaled, and placed images are
+// resampled bilinearly. Unlike PlaceAtPoint, placed images are clipped to dst (and dst needn't be RGBA).
+// If any operation is invalid (of an unknown kind, or missing the Args, Path or Image its kind uses), an error is
+// returned and nothing is drawn.
+func (rec *Recorder) Replay(dst *Image, scale float64) error {
+	if scale <= 0 {
+		return fmt.Errorf("replay scale must be positive, not %v", scale)
+	}
+	if err := rec.validate(); err != nil {
+		return err
+	}
+	exact := scale == 1
+	// sr returns the rectangle of pixels covered by the recorded one with corners (x0, y0) and (x1, y1).
+	sr := func(x0, y0, x1, y1 int) image.Rectangle {
+		s := func(v int) int { return int(math.Floor(float64(v)*scale + 0.5)) }
+		r := image.Rect(s(x0), s(y0), s(x1), s(y1))
+		// Keep rectangles at least one pixel across when shrinking, covering the pixel their start falls in.
+		if r.Dx() == 0 {
+			r.Min.X = int(math.Floor(float64(x0) * scale))
+			r.Max.X = r.Min.X + 1
+		}
+		if r.Dy() == 0 {
+			r.Min.Y = int(math.Floor(float64(y0) * scale))
+			r.Max.Y = r.Min.Y + 1
+		}
+		return r
+	}
+	m := ScaleAffine(scale, scale)
+	for i := range rec.Ops {
+		op := &rec.Ops[i]
+		// Placed images are drawn clipped even at scale 1.
+		if exact && op.Kind != OpBlit {
+			op.draw(dst)
+			continue
+		}
+		a, c := op.Args, op.Color
+		switch op.Kind {
+		case OpSetPixel:
+			dst.DrawFilledRect(sr(a[0], a[1], a[0]+1, a[1]+1), c...)
+		case OpHLine:
+			if a[0] <= a[2] {
+				dst.DrawFilledRect(sr(a[0], a[1], a[2]+1, a[1]+1), c...)
+			}
+		case OpVLine:
+			if a[1] <= a[2] {
+				dst.DrawFilledRect(sr(a[0], a[1], a[0]+1, a[2]+1), c...)
+			}
+		case OpCircleBorder:
+			if a[2] > 1 {
+				// The midpoint ring runs through the centers of pixels rad-1 from the center pixel.
+				p := (&Path{}).Ellipse((float64(a[0])+0.5)*scale, (float64(a[1])+0.5)*scale,
+					float64(a[2]-1)*scale, float64(a[2]-1)*scale)
+				dst.StrokePath(p, StrokeStyle{Width: math.Max(1, scale)}, c...)
+			}
+		case OpFilledCircle:
+			r := (float64(a[2]) + 0.5) * scale
+			dst.FillPath((&Path{}).Ellipse((float64(a[0])+0.5)*scale, (float64(a[1])+0.5)*scale, r, r),
+				FillNonZero, c...)
+		case OpFilledRect:
+			if a[0] < a[2] && a[1] < a[3] {
+				dst.DrawFilledRect(sr(a[0], a[1], a[2], a[3]), c...)
+			}
+		case OpFilledPolygon:
+			pts := make([]Vec2, len(op.Points))
+			for i, pt := range op.Points {
+				pts[i] = Vec2{pt.X * scale, pt.Y * scale}
+			}
+			dst.DrawFilledPolygon(pts, op.Rule, c...)
+		case OpFillPath:
+			dst.FillPath(op.Path.Transform(m), op.Rule, c...)
+		case OpStrokePath:
+			style := op.Stroke
+			style.Width *= scale
+			dst.StrokePath(op.Path.Transform(m), style, c...)
+		case OpBlit:
+			src, err := NewImage(op.Image)
+			if err != nil {
+				return err
+			}
+			if !exact {
+				if src, err = Transform(src, m, TransformOptions{Interp: InterpBilinear, Expand: true}); err != nil {
+					return err
+				}
+			}
+			r := sr(a[0], a[1], a[0], a[1])
+			r.Max = r.Min.Add(src.Rect.Size())
+			draw.Draw(dst, r, src, src.Rect.Min, draw.Src)
+		}
+	}
+	return nil
+}
+
+// Draw draws the recorded operations onto c verbatim, as they were drawn on the Recorder: onto an Image (where it is
+// the same as Replay at scale 1, except that placed images aren't clipped), an SVGWriter, or another Recorder.
+// As with Replay, if any operation is invalid an error is returned and nothing is drawn.
+func (rec *Recorder) Draw(c Canvas) error {
+	if err := rec.validate(); err != nil {
+		return err
+	}
+	for i := range rec.Ops {
+		rec.Ops[i].draw(c)
+	}
+	return nil
+}
+
+// validate returns an error for the first invalid recorded operation.
+func (rec *Recorder) validate() error {
+	for i := range rec.Ops {
+		if err := rec.Ops[i].validate(); err != nil {
+			return fmt.Errorf("op %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// draw draws op onto c. op must be valid.
+func (op *Op) draw(c Canvas) {
+	a, px := op.Args, op.Color
+	switch op.Kind {
+	case OpSetPixel:
+		c.SetPixel(a[0], a[1], px...)
+	case OpHLine:
+		c.DrawHLine(a[0], a[1], a[2], px...)
+	case OpVLine:
+		c.DrawVLine(a[0], a[1], a[2], px...)
+	case OpCircleBorder:
+		c.DrawCircleBorder(a[0], a[1], a[2], px...)
+	case OpFilledCircle:
+		c.DrawFilledCircle(a[0], a[1], a[2], px...)
+	case OpFilledRect:
+		c.DrawFilledRect(image.Rect(a[0], a[1], a[2], a[3]), px...)
+	case OpFilledPolygon:
+		c.DrawFilledPolygon(op.Points, op.Rule, px...)
+	case OpFillPath:
+		c.FillPath(op.Path, op.Rule, px...)
+	case OpStrokePath:
+		c.StrokePath(op.Path, op.Stroke, px...)
+	case OpBlit:
+		c.PlaceAtPoint(op.Image, image.Pt(a[0], a[1]))
+	}
+}
+
+// MarshalJSON encodes the recorded operations as a JSON array (see Op.MarshalJSON).
+func (rec *Recorder) MarshalJSON() ([]byte, error) {
+	if rec.Ops == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(rec.Ops)
+}
+
+// UnmarshalJSON replaces the recorded operations with those decoded from a JSON array written by MarshalJSON.
+func (rec *Recorder) UnmarshalJSON(b []byte) error {
+	var ops []Op
+	if err := json.Unmarshal(b, &ops); err != nil {
+		return err
+	}
+	rec.Ops = ops
+	return nil
+}
+
+// WriteSVG writes the recorded operations to w as an SVG document width x height pixels in size, by drawing them on
+// an SVGWriter. Nothing is written if any operation is invalid.
+func (rec *Recorder) WriteSVG(w io.Writer, width, height int) error {
+	if err := rec.validate(); err != nil {
+		return err
+	}
+	sw := NewSVGWriter(w, width, height)
+	for i := range rec.Ops {
+		rec.Ops[i].draw(sw)
+	}
+	return sw.Close()
+}
@@ -0,0 +1,269 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Vertex is a vertex of a triangle drawn by a Renderer.
+type Vertex struct {
+	Pos Vec3
+	// UV is the vertex's texture coordinates: (0, 0) is the top-left corner of the texture and (1, 1) its
+	// bottom-right, and the texture repeats beyond them.
+	UV Vec2
+	// Color is the vertex's color, interpolated across the triangle (Gouraud shading) and multiplied with the texture
+	// if there is one. nil means white.
+	Color color.Color
+}
+
+// CullMode selects which triangles a Renderer skips, according to which way they face.
+type CullMode int
+
+const (
+	// CullNone draws all triangles.
+	CullNone CullMode = iota
+	// CullBack skips back faces: triangles whose vertices appear clockwise on screen.
+	CullBack
+	// CullFront skips front faces: triangles whose vertices appear counter-clockwise on screen.
+	CullFront
+)
+
+// Renderer is a small software 3D rasterizer, for rendering meshes into an Image without a GPU. Vertices are
+// transformed to clip space by Transform, clipped against the near plane (and, well off the target, its sides), culled
+// (see Cull), and rasterized (see DrawFilledTriangle for which pixels are covered) with a depth test against Depth.
+// Colors and texture coordinates are interpolated with perspective correction, and colors which aren't fully opaque
+// are blended over the existing pixels (though they are depth tested and written like any others, so should be drawn
+// back to front, after everything opaque).
+//
+// The fields may be changed between draws, such as to give each mesh its own Transform or Texture.
+type Renderer struct {
+	Target *Image
+	// Depth is the depth buffer, with a value for each pixel of Target in row-major order. Depths run from 0 at the
+	// near plane to 1 at the far plane; a pixel is only drawn if it is nearer than the depth already there. If its
+	// length doesn't match Target (as after changing Target), it is replaced by a cleared buffer.
+	Depth []float32
+	// Transform maps vertex positions to clip space: typically projection.Mul(view).Mul(model), with the projection
+	// from PerspectiveMat4 or OrthoMat4.
+	Transform Mat4
+	Cull      CullMode
+	// Texture, if not nil, is mapped onto triangles by their vertices' UVs, interpolated with TextureInterp.
+	// Interpolation other than InterpNearest is only available for RGB and gray formats. An empty texture is
+	// transparent, so triangles drawn with it leave the target unchanged.
+	Texture       *Image
+	TextureInterp Interpolation
+
+	// pattern samples Texture, and is rebuilt when Texture or TextureInterp change.
+	pattern       *ImagePattern
+	patternFor    *Image
+	patternInterp Interpolation
+}
+
+// NewRenderer returns a Renderer drawing into target, with a cleared depth buffer, the identity Transform, and back
+// faces culled.
+func NewRenderer(target *Image) *Renderer {
+	r := &Renderer{
+		Target:    target,
+		Depth:     make([]float32, target.Rect.Dx()*target.Rect.Dy()),
+		Transform: IdentityMat4(),
+		Cull:      CullBack,
+	}
+	r.ClearDepth()
+	return r
+}
+
+// ClearDepth resets the depth buffer, so that anything drawn next is in front.
+func (r *Renderer) ClearDepth() {
+	inf := float32(math.Inf(1))
+	for i := range r.Depth {
+		r.Depth[i] = inf
+	}
+}
+
+// DrawTriangles draws a mesh of triangles. Each three entries of indices are the indices in vertices of the vertices
+// of a triangle; if indices is nil, each three successive vertices are a triangle.
+func (r *Renderer) DrawTriangles(vertices []Vertex, indices []int) {
+	if indices == nil {
+		indices = make([]int, len(vertices))
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+	for i := 0; i+2 < len(indices); i += 3 {
+		a, b, c := indices[i], indices[i+1], indices[i+2]
+		if a < 0 || b < 0 || c < 0 || a >= len(vertices) || b >= len(vertices) || c >= len(vertices) {
+			continue
+		}
+		r.DrawTriangle(vertices[a], vertices[b], vertices[c])
+	}
+}
+
+// clipVertex is a vertex in clip space, with its attributes: texture coordinates and premultiplied color (with
+// channels from 0 to 65535).
+type clipVertex struct {
+	pos   Vec4
+	uv    Vec2
+	color [4]float64
+}
+
+// lerp returns the vertex t of the way from v to w.
+func (v clipVertex) lerp(w clipVertex, t float64) clipVertex {
+	out := clipVertex{pos: v.pos.lerp(w.pos, t), uv: Vec2{v.uv.X + (w.uv.X-v.uv.X)*t, v.uv.Y + (w.uv.Y-v.uv.Y)*t}}
+	for ch := range out.color {
+		out.color[ch] = v.color[ch] + (w.color[ch]-v.color[ch])*t
+	}
+	return out
+}
+
+// renderGuardBand is how far beyond the target's sides triangles are clipped, as a multiple of the distance from its
+// center: with 2, the clipping region is twice the target's size in each direction. Clipping there rather than at the
+// target's sides means triangles crossing them needn't be cut, while keeping screen coordinates within
+// rasterTriangle's limits.
+const renderGuardBand = 2
+
+// clipPlanes are the planes triangles are clipped against in clip space: for each, the side where the function is
+// non-negative is kept. The first is the near plane, z = -w; the others bound the guard band.
+var clipPlanes = [...]func(p Vec4) float64{
+	func(p Vec4) float64 { return p.Z + p.W },
+	func(p Vec4) float64 { return renderGuardBand*p.W - p.X },
+	func(p Vec4) float64 { return renderGuardBand*p.W + p.X },
+	func(p Vec4) float64 { return renderGuardBand*p.W - p.Y },
+	func(p Vec4) float64 { return renderGuardBand*p.W + p.Y },
+}
+
+// screenVertex is a vertex after projection onto the target: its pixel coordinates, depth, the reciprocal of its
+// clip space W (for perspective correction), and its attributes.
+type screenVertex struct {
+	pt    Vec2
+	z     float64
+	invW  float64
+	uv    Vec2
+	color [4]float64
+}
+
+// DrawTriangle draws the triangle with vertices a, b and c.
+func (r *Renderer) DrawTriangle(a, b, c Vertex) {
+	if n := r.Target.Rect.Dx() * r.Target.Rect.Dy(); len(r.Depth) != n {
+		r.Depth = make([]float32, n)
+		r.ClearDepth()
+	}
+	var in [3]clipVertex
+	for i, v := range [3]Vertex{a, b, c} {
+		in[i] = clipVertex{pos: r.Transform.Apply(v.Pos), uv: v.UV, color: [4]float64{65535, 65535, 65535, 65535}}
+		if v.Color != nil {
+			cr, cg, cb, ca := v.Color.RGBA()
+			in[i].color = [4]float64{float64(cr), float64(cg), float64(cb), float64(ca)}
+		}
+	}
+
+	// Clip against each plane in turn, leaving a convex polygon.
+	poly := in[:]
+	for _, plane := range clipPlanes {
+		var next []clipVertex
+		for i := range poly {
+			p, q := poly[i], poly[(i+1)%len(poly)]
+			dp, dq := plane(p.pos), plane(q.pos)
+			if dp >= 0 {
+				next = append(next, p)
+			}
+			// Interpolate from the vertex inside, so that an edge shared by two triangles is cut at the same point.
+			if dp >= 0 && dq < 0 {
+				next = append(next, p.lerp(q, dp/(dp-dq)))
+			} else if dp < 0 && dq >= 0 {
+				next = append(next, q.lerp(p, dq/(dq-dp)))
+			}
+		}
+		if len(next) < 3 {
+			return
+		}
+		poly = next
+	}
+
+	// Project onto the target, mapping x and y from [-1, 1] (with y up) to its bounds, and z from [-1, 1] to [0, 1].
+	rect := r.Target.Rect
+	sv := make([]screenVertex, len(poly))
+	for i, v := range poly {
+		// Within the guard band W >= 0, but with an unusual Transform it can be 0 (with X and Y 0 too).
+		w := math.Max(v.pos.W, 1e-9)
+		sv[i] = screenVertex{
+			pt: Vec2{
+				float64(rect.Min.X) + (v.pos.X/w+1)/2*float64(rect.Dx()),
+				float64(rect.Min.Y) + (1-v.pos.Y/w)/2*float64(rect.Dy()),
+			},
+			z: (v.pos.Z/w + 1) / 2, invW: 1 / w, uv: v.uv, color: v.color,
+		}
+	}
+	for i := 1; i+1 < len(sv); i++ {
+		r.rasterize(sv[0], sv[i], sv[i+1])
+	}
+}
+
+// rasterize culls and draws a projected triangle.
+func (r *Renderer) rasterize(a, b, c screenVertex) {
+	// With y down, counter-clockwise on screen is a negative signed area.
+	area := (b.pt.X-a.pt.X)*(c.pt.Y-a.pt.Y) - (b.pt.Y-a.pt.Y)*(c.pt.X-a.pt.X)
+	if r.Cull == CullBack && area > 0 || r.Cull == CullFront && area < 0 {
+		return
+	}
+	pattern := r.texturePattern()
+	var tw, th float64
+	if pattern != nil {
+		if r.Texture.Rect.Empty() {
+			return
+		}
+		tw, th = float64(r.Texture.Rect.Dx()), float64(r.Texture.Rect.Dy())
+	}
+	vs := [3]screenVertex{a, b, c}
+	img, rect := r.Target, r.Target.Rect
+	rasterTriangle([3]Vec2{a.pt, b.pt, c.pt}, rect, func(x, y int, l [3]float64) {
+		z := l[0]*a.z + l[1]*b.z + l[2]*c.z
+		di := (y-rect.Min.Y)*rect.Dx() + (x - rect.Min.X)
+		if z < 0 || z > 1 || float32(z) >= r.Depth[di] {
+			return
+		}
+		// Attributes vary linearly in clip space, so over the screen it is their values divided by W which do.
+		var pw [3]float64
+		sum := 0.0
+		for i := range pw {
+			pw[i] = l[i] * vs[i].invW
+			sum += pw[i]
+		}
+		var col [4]float64
+		var uv Vec2
+		for i, v := range vs {
+			f := pw[i] / sum
+			for ch := range col {
+				col[ch] += f * v.color[ch]
+			}
+			uv.X, uv.Y = uv.X+f*v.uv.X, uv.Y+f*v.uv.Y
+		}
+		if pattern != nil {
+			t := pattern.colorAt(uv.X*tw, uv.Y*th)
+			ta := float64(t.A)
+			tex := [4]float64{float64(t.R) * ta / 65535, float64(t.G) * ta / 65535, float64(t.B) * ta / 65535, ta}
+			for ch := range col {
+				col[ch] = col[ch] * tex[ch] / 65535
+			}
+		}
+		out := premulToNRGBA64(col)
+		if out.A == 0 {
+			return
+		}
+		img.paintPixel(img.offset(x, y), x, y, out)
+		r.Depth[di] = float32(z)
+	})
+}
+
+// texturePattern returns the pattern for sampling Texture, or nil if there is no texture.
+func (r *Renderer) texturePattern() *ImagePattern {
+	if r.Texture == nil {
+		return nil
+	}
+	if r.pattern == nil || r.patternFor != r.Texture || r.patternInterp != r.TextureInterp {
+		r.pattern = NewImagePattern(r.Texture, image.Point{})
+		// The identity is always invertible.
+		_ = r.pattern.SetTransform(IdentityAffine(), r.TextureInterp)
+		r.patternFor, r.patternInterp = r.Texture, r.TextureInterp
+	}
+	return r.pattern
+}
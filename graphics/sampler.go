@@ -0,0 +1,145 @@
+package graphics
+
+import "math"
+
+// EdgeMode selects what pixels beyond the edges of an image are considered to be, when an operation (interpolation,
+// convolution, padding etc.) needs them.
+type EdgeMode int
+
+const (
+	// EdgeClamp repeats the nearest edge pixel: aaa|abc|ccc.
+	EdgeClamp EdgeMode = iota
+	// EdgeWrap tiles the image: abc|abc|abc.
+	EdgeWrap
+	// EdgeMirror reflects the image about its edges, repeating the edge pixels: cba|abc|cba.
+	EdgeMirror
+	// EdgeConstant uses a constant color: kkk|abc|kkk.
+	EdgeConstant
+)
+
+// edgeCoord maps the coordinate i onto the range [lo,hi) according to mode. It returns false if i is outside the
+// range and mode is EdgeConstant (or an unknown mode), or if the range is empty, in which case the constant should be
+// used instead.
+func edgeCoord(i, lo, hi int, mode EdgeMode) (int, bool) {
+	if i >= lo && i < hi {
+		return i, true
+	}
+	if hi <= lo {
+		return 0, false
+	}
+	n := hi - lo
+	switch mode {
+	case EdgeClamp:
+		if i < lo {
+			return lo, true
+		}
+		return hi - 1, true
+	case EdgeWrap:
+		return ((i-lo)%n+n)%n + lo, true
+	case EdgeMirror:
+		m := ((i-lo)%(2*n) + 2*n) % (2 * n)
+		if m >= n {
+			m = 2*n - 1 - m
+		}
+		return m + lo, true
+	}
+	return 0, false
+}
+
+// Sampler computes pixel values at fractional coordinates.
+type Sampler interface {
+	// Sample writes the value of each channel at (x, y) into px, which must have at least Channels() elements.
+	// Coordinates are such that pixel centers fall on integers, so Sample(3, 4, px) returns exactly the pixel at
+	// (3, 4) whatever the interpolation, and Sample(3.5, 4, px) is halfway between it and the pixel to its right.
+	// Values are in the image's channel range: [0,255] for 8-bit formats and [0,65535] for 16-bit ones (cubic
+	// interpolation can overshoot slightly; callers storing the values should clamp them).
+	Sample(x, y float64, px []float64)
+	// Channels returns the number of channels per pixel.
+	Channels() int
+}
+
+// NewSampler returns a Sampler which reads img using interp, treating pixels beyond img's bounds according to edge.
+// constant holds the pixelBytes used by EdgeConstant; as with SetPixel, only the first n bytes of a pixel may be
+// provided (the rest are zero). The Sampler reads img.Pix directly, so it sees any later changes to img, and is safe
+// for concurrent use as long as img isn't being written.
+func NewSampler(img *Image, interp Interpolation, edge EdgeMode, constant ...uint8) Sampler {
+	s := &imageSampler{img: img, interp: interp, edge: edge, ch: img.channels()}
+	if edge == EdgeConstant {
+		s.constant = img.bytesToValues(constant)
+	}
+	return s
+}
+
+type imageSampler struct {
+	img      *Image
+	interp   Interpolation
+	edge     EdgeMode
+	ch       int
+	constant []float64
+}
+
+func (s *imageSampler) Channels() int {
+	return s.ch
+}
+
+// at returns the value of channel c of the pixel at integer coordinates (x, y), applying the edge mode. Beyond an
+// empty image, with no constant, it is 0.
+func (s *imageSampler) at(x, y, c int) float64 {
+	r := s.img.Rect
+	x, okX := edgeCoord(x, r.Min.X, r.Max.X, s.edge)
+	y, okY := edgeCoord(y, r.Min.Y, r.Max.Y, s.edge)
+	if !okX || !okY {
+		if s.constant == nil {
+			return 0
+		}
+		return s.constant[c]
+	}
+	return s.img.readChannel(s.img.offset(x, y) + c*s.img.depth)
+}
+
+func (s *imageSampler) Sample(x, y float64, px []float64) {
+	switch s.interp {
+	case InterpBilinear:
+		x0, y0 := math.Floor(x), math.Floor(y)
+		fx, fy := x-x0, y-y0
+		ix, iy := int(x0), int(y0)
+		for c := 0; c < s.ch; c++ {
+			top := s.at(ix, iy, c)*(1-fx) + s.at(ix+1, iy, c)*fx
+			bottom := s.at(ix, iy+1, c)*(1-fx) + s.at(ix+1, iy+1, c)*fx
+			px[c] = top*(1-fy) + bottom*fy
+		}
+	case InterpBicubic:
+		x0, y0 := math.Floor(x), math.Floor(y)
+		wx, wy := catmullRomWeights(x-x0), catmullRomWeights(y-y0)
+		ix, iy := int(x0)-1, int(y0)-1
+		for c := 0; c < s.ch; c++ {
+			var v float64
+			for j := 0; j < 4; j++ {
+				var row float64
+				for i := 0; i < 4; i++ {
+					row += s.at(ix+i, iy+j, c) * wx[i]
+				}
+				v += row * wy[j]
+			}
+			px[c] = v
+		}
+	default:
+		ix, iy := int(math.Floor(x+0.5)), int(math.Floor(y+0.5))
+		for c := 0; c < s.ch; c++ {
+			px[c] = s.at(ix, iy, c)
+		}
+	}
+}
+
+// catmullRomWeights returns the weights of the 4 pixels at offsets -1, 0, 1 and 2 for a sample at fraction t in [0,1)
+// of the way between pixels 0 and 1.
+func catmullRomWeights(t float64) [4]float64 {
+	t2 := t * t
+	t3 := t2 * t
+	return [4]float64{
+		-0.5*t3 + t2 - 0.5*t,
+		1.5*t3 - 2.5*t2 + 1,
+		-1.5*t3 + 2*t2 + 0.5*t,
+		0.5*t3 - 0.5*t2,
+	}
+}
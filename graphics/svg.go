@@ -0,0 +1,261 @@
+package graphics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SVGWriter is a Canvas which writes what is drawn on it to an SVG document, so that the same drawing code can produce
+// both raster images and vector versions of them (such as for print). Shapes are written as SVG's own elements, with
+// pixel coordinates mapped so that they cover the same area as when drawn on an Image; placed images are embedded as
+// PNG. Colors are taken to be RGBA pixelBytes (as SetPixel assumes), with missing channels 0 but alpha defaulting to
+// opaque.
+//
+// As well as the Canvas methods, SVGWriter has DrawText and DrawTextInRect, as Image does, and a few which write
+// shapes without a raster equivalent: FillEllipse, StrokeEllipse, StrokeLine and PlaceImage.
+//
+// Writes are buffered, and the first error stops any further output; Close finishes the document and returns it.
+type SVGWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewSVGWriter starts an SVG document width x height pixels in size on w. Close must be called to finish it.
+func NewSVGWriter(w io.Writer, width, height int) *SVGWriter {
+	sw := &SVGWriter{w: bufio.NewWriter(w)}
+	sw.printf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	return sw
+}
+
+// Close ends the document and flushes it to the underlying writer. It returns the first error encountered while
+// writing, if any. Nothing may be drawn after Close.
+func (sw *SVGWriter) Close() error {
+	if sw.w == nil {
+		return errors.New("svg writer is already closed")
+	}
+	sw.printf("</svg>\n")
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	sw.w = nil
+	return sw.err
+}
+
+func (sw *SVGWriter) printf(format string, args ...interface{}) {
+	if sw.err != nil {
+		return
+	}
+	if sw.w == nil {
+		sw.err = errors.New("svg writer is closed")
+		return
+	}
+	_, sw.err = fmt.Fprintf(sw.w, format, args...)
+}
+
+// rect writes a rectangle covering the pixels of r.
+func (sw *SVGWriter) rect(r image.Rectangle, pixelBytes []uint8) {
+	if r.Empty() {
+		return
+	}
+	sw.printf(`<rect x="%d" y="%d" width="%d" height="%d" %s/>`+"\n",
+		r.Min.X, r.Min.Y, r.Dx(), r.Dy(), svgPaint("fill", pixelBytes))
+}
+
+// SetPixel writes a 1x1 rectangle covering pixel (x, y).
+func (sw *SVGWriter) SetPixel(x, y int, pixelBytes ...uint8) {
+	sw.rect(image.Rect(x, y, x+1, y+1), pixelBytes)
+}
+
+// DrawHLine writes a rectangle 1 pixel tall covering the pixels from (x0,y0) to (x1,y0), as Image.DrawHLine sets.
+func (sw *SVGWriter) DrawHLine(x0, y0, x1 int, pixelBytes ...uint8) {
+	if x0 <= x1 {
+		sw.rect(image.Rect(x0, y0, x1+1, y0+1), pixelBytes)
+	}
+}
+
+// DrawVLine writes a rectangle 1 pixel wide covering the pixels from (x0,y0) to (x0,y1), as Image.DrawVLine sets.
+func (sw *SVGWriter) DrawVLine(x0, y0, y1 int, pixelBytes ...uint8) {
+	if y0 <= y1 {
+		sw.rect(image.Rect(x0, y0, x0+1, y1+1), pixelBytes)
+	}
+}
+
+// DrawCircleBorder writes a circle stroked 1 pixel wide, through the centers of the pixels Image.DrawCircleBorder
+// sets.
+func (sw *SVGWriter) DrawCircleBorder(cx, cy, rad int, pixelBytes ...uint8) {
+	if rad > 1 {
+		sw.printf(`<circle cx="%s" cy="%s" r="%d" fill="none" %s/>`+"\n",
+			svgNum(float64(cx)+0.5), svgNum(float64(cy)+0.5), rad-1, svgPaint("stroke", pixelBytes))
+	}
+}
+
+// DrawFilledCircle writes a filled circle covering the pixels Image.DrawFilledCircle sets.
+func (sw *SVGWriter) DrawFilledCircle(cx, cy, rad int, pixelBytes ...uint8) {
+	sw.printf(`<circle cx="%s" cy="%s" r="%s" %s/>`+"\n",
+		svgNum(float64(cx)+0.5), svgNum(float64(cy)+0.5), svgNum(float64(rad)+0.5), svgPaint("fill", pixelBytes))
+}
+
+// DrawFilledRect writes a rectangle covering r.
+func (sw *SVGWriter) DrawFilledRect(r image.Rectangle, pixelBytes ...uint8) {
+	sw.rect(r, pixelBytes)
+}
+
+// DrawFilledPolygon writes a filled polygon with vertices pts, filled under rule.
+func (sw *SVGWriter) DrawFilledPolygon(pts []Vec2, rule FillRule, pixelBytes ...uint8) {
+	coords := make([]string, len(pts))
+	for i, pt := range pts {
+		coords[i] = svgNum(pt.X) + "," + svgNum(pt.Y)
+	}
+	sw.printf(`<polygon points="%s" fill-rule="%s" %s/>`+"\n",
+		strings.Join(coords, " "), svgFillRule(rule), svgPaint("fill", pixelBytes))
+}
+
+// FillPath writes p, filled under rule.
+func (sw *SVGWriter) FillPath(p *Path, rule FillRule, pixelBytes ...uint8) {
+	sw.printf(`<path d="%s" fill-rule="%s" %s/>`+"\n", p.SVGData(), svgFillRule(rule), svgPaint("fill", pixelBytes))
+}
+
+// StrokePath writes p, stroked with style.
+func (sw *SVGWriter) StrokePath(p *Path, style StrokeStyle, pixelBytes ...uint8) {
+	sw.printf(`<path d="%s" fill="none" %s/>`+"\n", p.SVGData(), svgStroke(style, pixelBytes))
+}
+
+// FillEllipse writes a filled ellipse centered on (cx, cy) with radii rx and ry. Coordinates are in pixels, as for
+// Path.
+func (sw *SVGWriter) FillEllipse(cx, cy, rx, ry float64, pixelBytes ...uint8) {
+	sw.printf(`<ellipse cx="%s" cy="%s" rx="%s" ry="%s" %s/>`+"\n",
+		svgNum(cx), svgNum(cy), svgNum(rx), svgNum(ry), svgPaint("fill", pixelBytes))
+}
+
+// StrokeEllipse writes an ellipse centered on (cx, cy) with radii rx and ry, stroked with style.
+func (sw *SVGWriter) StrokeEllipse(cx, cy, rx, ry float64, style StrokeStyle, pixelBytes ...uint8) {
+	sw.printf(`<ellipse cx="%s" cy="%s" rx="%s" ry="%s" fill="none" %s/>`+"\n",
+		svgNum(cx), svgNum(cy), svgNum(rx), svgNum(ry), svgStroke(style, pixelBytes))
+}
+
+// StrokeLine writes a line from (x0, y0) to (x1, y1), stroked with style.
+func (sw *SVGWriter) StrokeLine(x0, y0, x1, y1 float64, style StrokeStyle, pixelBytes ...uint8) {
+	sw.printf(`<line x1="%s" y1="%s" x2="%s" y2="%s" %s/>`+"\n",
+		svgNum(x0), svgNum(y0), svgNum(x1), svgNum(y1), svgStroke(style, pixelBytes))
+}
+
+// PlaceAtPoint embeds src with its top-left corner at pt.
+func (sw *SVGWriter) PlaceAtPoint(src *image.RGBA, pt image.Point) {
+	sw.PlaceImage(src, image.Rectangle{Min: pt, Max: pt.Add(src.Rect.Size())})
+}
+
+// PlaceImage embeds img (as PNG), scaled to fill r.
+func (sw *SVGWriter) PlaceImage(img image.Image, r image.Rectangle) {
+	if sw.err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	if sw.err = png.Encode(&buf, img); sw.err != nil {
+		return
+	}
+	sw.printf(`<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="none" href="data:image/png;base64,%s"/>`+
+		"\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// DrawText writes the text s as Image.DrawText draws it with font f. Each line is a text element in a generic
+// monospace font sized to f's line height, stretched to the width f gives it, so layout matches the raster version
+// even though the glyphs don't.
+func (sw *SVGWriter) DrawText(f *BitmapFont, x, y int, s string, pixelBytes ...uint8) image.Point {
+	pen := image.Pt(x, y)
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			pen = image.Pt(x, pen.Y+f.LineHeight())
+		}
+		sw.text(f, pen.X, pen.Y, line, pixelBytes)
+		pen.X += f.MeasureString(line)
+	}
+	return pen
+}
+
+// DrawTextInRect writes the text s wrapped and aligned within r, as Image.DrawTextInRect draws it with font f (see
+// DrawText). Unlike Image.DrawTextInRect, it isn't clipped to r.
+func (sw *SVGWriter) DrawTextInRect(f *BitmapFont, r image.Rectangle, s string, align TextAlign, valign VerticalAlign,
+	pixelBytes ...uint8) int {
+	lines := f.WrapString(s, r.Dx())
+	lh := f.LineHeight()
+	y := r.Min.Y
+	switch valign {
+	case AlignMiddle:
+		y += (r.Dy() - len(lines)*lh) / 2
+	case AlignBottom:
+		y += r.Dy() - len(lines)*lh
+	}
+	for _, l := range lines {
+		x := r.Min.X
+		switch align {
+		case AlignCenter:
+			x += (r.Dx() - f.MeasureString(l)) / 2
+		case AlignRight:
+			x += r.Dx() - f.MeasureString(l)
+		}
+		sw.text(f, x, y, l, pixelBytes)
+		y += lh
+	}
+	return len(lines)
+}
+
+// text writes a single line of text with its top-left at (x, y).
+func (sw *SVGWriter) text(f *BitmapFont, x, y int, line string, pixelBytes []uint8) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	var esc strings.Builder
+	if err := xml.EscapeText(&esc, []byte(line)); err != nil && sw.err == nil {
+		sw.err = err
+	}
+	sw.printf(`<text x="%d" y="%d" font-family="monospace" font-size="%d" textLength="%d" `+
+		`lengthAdjust="spacingAndGlyphs" xml:space="preserve" %s>%s</text>`+"\n",
+		x, y+f.Ascent, f.LineHeight(), f.MeasureString(line), svgPaint("fill", pixelBytes), esc.String())
+}
+
+// svgNum formats v as briefly as possible.
+func svgNum(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// svgFillRule returns the SVG name of rule.
+func svgFillRule(rule FillRule) string {
+	if rule == FillEvenOdd {
+		return "evenodd"
+	}
+	return "nonzero"
+}
+
+// svgPaint returns the SVG attributes setting the fill or stroke (as attr) to the RGBA pixelBytes c.
+func svgPaint(attr string, c []uint8) string {
+	var rgba [4]uint8
+	rgba[3] = 255
+	copy(rgba[:], c)
+	s := fmt.Sprintf(`%s="#%02x%02x%02x"`, attr, rgba[0], rgba[1], rgba[2])
+	if rgba[3] != 255 {
+		s += fmt.Sprintf(` %s-opacity="%s"`, attr, strconv.FormatFloat(float64(rgba[3])/255, 'g', 4, 64))
+	}
+	return s
+}
+
+// svgStroke returns the SVG attributes for a stroke of style in the color c.
+func svgStroke(style StrokeStyle, c []uint8) string {
+	caps := map[LineCap]string{CapButt: "butt", CapRound: "round", CapSquare: "square"}
+	joins := map[LineJoin]string{JoinMiter: "miter", JoinRound: "round", JoinBevel: "bevel"}
+	miter := style.MiterLimit
+	if miter < 1 {
+		miter = 4
+	}
+	return fmt.Sprintf(`%s stroke-width="%s" stroke-linecap="%s" stroke-linejoin="%s" stroke-miterlimit="%s"`,
+		svgPaint("stroke", c), svgNum(style.Width), caps[style.Cap], joins[style.Join], svgNum(miter))
+}
@@ -0,0 +1,361 @@
+package graphics
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Glyph is the bitmap of a character in a BitmapFont.
+type Glyph struct {
+	// Width and Height are the bitmap's size in pixels.
+	Width, Height int
+	// XOffset and YOffset are the position of the bitmap's top-left corner relative to the pen position, which is on
+	// the baseline. As y increases downward, YOffset is usually negative.
+	XOffset, YOffset int
+	// Advance is how far the pen moves right after the glyph.
+	Advance int
+	// Bits holds the bitmap's rows, top first, each (Width+7)/8 bytes long, with the most significant bit of a row's
+	// first byte its leftmost pixel.
+	Bits []uint8
+}
+
+// set returns whether the pixel at (x, y) of the bitmap is set.
+func (g *Glyph) set(x, y int) bool {
+	return g.Bits[y*((g.Width+7)/8)+x/8]&(0x80>>uint(x%8)) != 0
+}
+
+// BitmapFont is a font of Glyphs, for DrawText and DrawTextInRect.
+type BitmapFont struct {
+	Name string
+	// Ascent is the distance from the top of a line to its baseline, and Descent from the baseline to the bottom of
+	// the line.
+	Ascent, Descent int
+	Glyphs          map[rune]*Glyph
+	// Fallback is drawn for runes without a glyph of their own. If it is nil, they are skipped.
+	Fallback *Glyph
+}
+
+// LineHeight returns the distance between successive lines of text, Ascent + Descent.
+func (f *BitmapFont) LineHeight() int {
+	return f.Ascent + f.Descent
+}
+
+// glyph returns the glyph for r, or nil if there is none (and no fallback).
+func (f *BitmapFont) glyph(r rune) *Glyph {
+	if g, ok := f.Glyphs[r]; ok {
+		return g
+	}
+	return f.Fallback
+}
+
+// Scale returns a copy of f with every glyph (and the metrics) enlarged by the integer factor n, with each pixel
+// becoming an n x n block.
+func (f *BitmapFont) Scale(n int) *BitmapFont {
+	if n < 1 {
+		n = 1
+	}
+	scale := func(g *Glyph) *Glyph {
+		if g == nil {
+			return nil
+		}
+		s := &Glyph{
+			Width: g.Width * n, Height: g.Height * n,
+			XOffset: g.XOffset * n, YOffset: g.YOffset * n, Advance: g.Advance * n,
+		}
+		stride := (s.Width + 7) / 8
+		s.Bits = make([]uint8, stride*s.Height)
+		for y := 0; y < s.Height; y++ {
+			for x := 0; x < s.Width; x++ {
+				if g.set(x/n, y/n) {
+					s.Bits[y*stride+x/8] |= 0x80 >> uint(x%8)
+				}
+			}
+		}
+		return s
+	}
+	sf := &BitmapFont{
+		Name: f.Name, Ascent: f.Ascent * n, Descent: f.Descent * n,
+		Glyphs: make(map[rune]*Glyph, len(f.Glyphs)), Fallback: scale(f.Fallback),
+	}
+	for r, g := range f.Glyphs {
+		sf.Glyphs[r] = scale(g)
+	}
+	return sf
+}
+
+// MeasureString returns the width in pixels of the single line of text s (that is, the total advance of its glyphs).
+func (f *BitmapFont) MeasureString(s string) int {
+	w := 0
+	for _, r := range s {
+		if g := f.glyph(r); g != nil {
+			w += g.Advance
+		}
+	}
+	return w
+}
+
+// Measure returns the size of the text s, which may have several lines separated by '\n': the width of its widest
+// line, and the line height times the number of lines.
+func (f *BitmapFont) Measure(s string) image.Point {
+	lines := strings.Split(s, "\n")
+	var size image.Point
+	for _, l := range lines {
+		if w := f.MeasureString(l); w > size.X {
+			size.X = w
+		}
+	}
+	size.Y = len(lines) * f.LineHeight()
+	return size
+}
+
+// WrapString splits s into lines no wider than width: at each '\n', and between words (at spaces) where a line would
+// otherwise be too wide. Words too wide for a line on their own are broken between characters.
+func (f *BitmapFont) WrapString(s string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line, lineW := "", 0
+		for _, word := range strings.Split(para, " ") {
+			ww := f.MeasureString(word)
+			sep := 0
+			if line != "" {
+				sep = f.MeasureString(" ")
+			}
+			if lineW+sep+ww <= width {
+				if line != "" {
+					line += " "
+				}
+				line, lineW = line+word, lineW+sep+ww
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+				line, lineW = "", 0
+			}
+			// Break words which don't fit on a line of their own.
+			for ww > width && word != "" {
+				n, w := 0, 0
+				for i, r := range word {
+					gw := f.MeasureString(string(r))
+					if w+gw > width && i > 0 {
+						break
+					}
+					n, w = i+utf8.RuneLen(r), w+gw
+				}
+				lines = append(lines, word[:n])
+				word = word[n:]
+				ww = f.MeasureString(word)
+			}
+			line, lineW = word, ww
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// TextAlign selects the horizontal alignment of lines of text within a rectangle.
+type TextAlign int
+
+const (
+	AlignLeft TextAlign = iota
+	AlignCenter
+	AlignRight
+)
+
+// VerticalAlign selects the vertical alignment of a block of text within a rectangle.
+type VerticalAlign int
+
+const (
+	AlignTop VerticalAlign = iota
+	AlignMiddle
+	AlignBottom
+)
+
+// DrawText draws the text s with font f, with the top-left of its first line at (x, y), of the color provided by
+// pixelBytes. A '\n' starts a new line, back at x. Glyph rows are written directly into Pix, clipped to the image.
+// It returns the pen position after the last glyph: the right end of the last line, and the top of that line.
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) DrawText(f *BitmapFont, x, y int, s string, pixelBytes ...uint8) image.Point {
+	return img.drawText(f, x, y, s, img.Rect, pixelBytes)
+}
+
+// DrawTextInRect draws the text s with font f within r, of the color provided by pixelBytes: the text is wrapped to
+// r's width (see WrapString), each line is aligned horizontally with align, and the block of lines vertically with
+// valign. Anything outside r is clipped. It returns the number of lines the text was wrapped into.
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) DrawTextInRect(f *BitmapFont, r image.Rectangle, s string, align TextAlign, valign VerticalAlign,
+	pixelBytes ...uint8) int {
+	lines := f.WrapString(s, r.Dx())
+	lh := f.LineHeight()
+	y := r.Min.Y
+	switch valign {
+	case AlignMiddle:
+		y += (r.Dy() - len(lines)*lh) / 2
+	case AlignBottom:
+		y += r.Dy() - len(lines)*lh
+	}
+	clip := r.Intersect(img.Rect)
+	for _, l := range lines {
+		x := r.Min.X
+		switch align {
+		case AlignCenter:
+			x += (r.Dx() - f.MeasureString(l)) / 2
+		case AlignRight:
+			x += r.Dx() - f.MeasureString(l)
+		}
+		img.drawText(f, x, y, l, clip, pixelBytes)
+		y += lh
+	}
+	return len(lines)
+}
+
+// drawText draws s as DrawText does, clipped to clip (which must be within img).
+func (img *Image) drawText(f *BitmapFont, x, y int, s string, clip image.Rectangle, pixelBytes []uint8) image.Point {
+	pen := image.Pt(x, y)
+	if len(pixelBytes) > img.bpp {
+		return pen
+	}
+	for _, r := range s {
+		if r == '\n' {
+			pen = image.Pt(x, pen.Y+f.LineHeight())
+			continue
+		}
+		g := f.glyph(r)
+		if g == nil {
+			continue
+		}
+		img.drawGlyph(g, pen.X+g.XOffset, pen.Y+f.Ascent+g.YOffset, clip, pixelBytes)
+		pen.X += g.Advance
+	}
+	return pen
+}
+
+// drawGlyph draws the bitmap of g with its top-left at (x0, y0), clipped to clip.
+func (img *Image) drawGlyph(g *Glyph, x0, y0 int, clip image.Rectangle, pixelBytes []uint8) {
+	r := image.Rect(x0, y0, x0+g.Width, y0+g.Height).Intersect(clip)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		o := img.offset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x, o = x+1, o+img.bpp {
+			if g.set(x-x0, y-y0) {
+				copy(img.Pix[o:o+len(pixelBytes)], pixelBytes)
+			}
+		}
+	}
+}
+
+var (
+	//go:embed fonts/font6x8.txt
+	font6x8Data string
+	//go:embed fonts/font8x8.txt
+	font8x8Data string
+	//go:embed fonts/font8x16.txt
+	font8x16Data string
+)
+
+// builtinFont lazily parses one of the embedded fonts.
+type builtinFont struct {
+	data *string
+	once sync.Once
+	font *BitmapFont
+}
+
+func (b *builtinFont) get() *BitmapFont {
+	b.once.Do(func() {
+		var err error
+		if b.font, err = parseGlyphArt(*b.data); err != nil {
+			panic(fmt.Sprintf("graphics: built-in font: %v", err))
+		}
+	})
+	return b.font
+}
+
+var (
+	font6x8  = builtinFont{data: &font6x8Data}
+	font8x8  = builtinFont{data: &font8x8Data}
+	font8x16 = builtinFont{data: &font8x16Data}
+)
+
+// Font6x8 returns the smallest built-in monospace font: 5x7 glyphs (with descenders below) in a 6x8 cell, covering
+// printable ASCII, with a box as the fallback for other characters. The built-in fonts are shared, so shouldn't be
+// modified; Scale returns an enlarged copy (so Font6x8().Scale(2) is a 12x16 font).
+func Font6x8() *BitmapFont {
+	return font6x8.get()
+}
+
+// Font8x8 returns the built-in 8x8 monospace font: 7x7 glyphs (with descenders below) in an 8x8 cell, covering the
+// same characters as Font6x8.
+func Font8x8() *BitmapFont {
+	return font8x8.get()
+}
+
+// Font8x16 returns the built-in 8x16 monospace font: 7x10 glyphs (with 2 rows of space above, and descenders below)
+// in an 8x16 cell, covering the same characters as Font6x8.
+func Font8x16() *BitmapFont {
+	return font8x16.get()
+}
+
+// parseGlyphArt parses a monospace font drawn as text: a "font <name> <width> <height> <ascent>" line, then for
+// each glyph a "char <hex code point>" line followed by height rows of '#' (set) and '.' (clear). Lines starting
+// with '#' before the font line are comments. Code point U+FFFD, if present, becomes the fallback.
+func parseGlyphArt(data string) (*BitmapFont, error) {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	var f *BitmapFont
+	var width, height int
+	var g *Glyph
+	row, line := 0, 0
+	for sc.Scan() {
+		line++
+		s := sc.Text()
+		if f == nil {
+			if s == "" || s[0] == '#' {
+				continue
+			}
+			var name string
+			var ascent int
+			if _, err := fmt.Sscanf(s, "font %s %d %d %d", &name, &width, &height, &ascent); err != nil {
+				return nil, fmt.Errorf("line %d: invalid font line: %v", line, err)
+			}
+			f = &BitmapFont{Name: name, Ascent: ascent, Descent: height - ascent, Glyphs: make(map[rune]*Glyph)}
+			continue
+		}
+		if strings.HasPrefix(s, "char ") {
+			if g != nil && row != height {
+				return nil, fmt.Errorf("line %d: previous glyph has %d rows, not %d", line, row, height)
+			}
+			c, err := strconv.ParseUint(strings.TrimSpace(s[5:]), 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid code point: %v", line, err)
+			}
+			g = &Glyph{Width: width, Height: height, YOffset: -f.Ascent, Advance: width,
+				Bits: make([]uint8, (width+7)/8*height)}
+			f.Glyphs[rune(c)] = g
+			row = 0
+			continue
+		}
+		if g == nil || row >= height || len(s) > width {
+			return nil, fmt.Errorf("line %d: unexpected %q", line, s)
+		}
+		for x, c := range s {
+			if c == '#' {
+				g.Bits[row*((width+7)/8)+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+		row++
+	}
+	if f == nil {
+		return nil, errors.New("no font line")
+	}
+	if g != nil && row != height {
+		return nil, fmt.Errorf("last glyph has %d rows, not %d", row, height)
+	}
+	if fb, ok := f.Glyphs[0xfffd]; ok {
+		f.Fallback = fb
+	}
+	return f, nil
+}
@@ -0,0 +1,289 @@
+package graphics
+
+import (
+	"image"
+	"math"
+)
+
+// Affine is a 2D affine transformation matrix. It maps (x, y) to
+// (m[0]*x + m[1]*y + m[2], m[3]*x + m[4]*y + m[5]); that is, it is the top two rows of a 3x3 matrix whose bottom row
+// is (0, 0, 1).
+// Coordinates are image (pixel) coordinates, with y increasing downward, so a positive rotation angle is clockwise
+// on screen.
+type Affine [6]float64
+
+// IdentityAffine returns the identity transformation.
+func IdentityAffine() Affine {
+	return Affine{1, 0, 0, 0, 1, 0}
+}
+
+// TranslateAffine returns a transformation which translates by (tx, ty).
+func TranslateAffine(tx, ty float64) Affine {
+	return Affine{1, 0, tx, 0, 1, ty}
+}
+
+// ScaleAffine returns a transformation which scales by sx horizontally and sy vertically, about the origin.
+func ScaleAffine(sx, sy float64) Affine {
+	return Affine{sx, 0, 0, 0, sy, 0}
+}
+
+// RotateAffine returns a transformation which rotates by theta radians (clockwise on screen) about the origin.
+// Multiples of a quarter turn are snapped to exact 0/1/-1 entries, so that Transform can recognize them and take its
+// lossless path.
+func RotateAffine(theta float64) Affine {
+	sin, cos := math.Sincos(theta)
+	return Affine{snapUnit(cos), -snapUnit(sin), 0, snapUnit(sin), snapUnit(cos), 0}
+}
+
+// RotateAboutAffine returns a transformation which rotates by theta radians (clockwise on screen) about (cx, cy).
+func RotateAboutAffine(theta, cx, cy float64) Affine {
+	return TranslateAffine(cx, cy).Mul(RotateAffine(theta)).Mul(TranslateAffine(-cx, -cy))
+}
+
+// ShearAffine returns a transformation which shears by shx horizontally (x += shx*y) and shy vertically
+// (y += shy*x).
+func ShearAffine(shx, shy float64) Affine {
+	return Affine{1, shx, 0, shy, 1, 0}
+}
+
+// Mul returns the product m*n, which is the transformation that applies n and then m.
+// So TranslateAffine(10, 0).Mul(RotateAffine(a)) rotates and then translates.
+func (m Affine) Mul(n Affine) Affine {
+	return Affine{
+		m[0]*n[0] + m[1]*n[3], m[0]*n[1] + m[1]*n[4], m[0]*n[2] + m[1]*n[5] + m[2],
+		m[3]*n[0] + m[4]*n[3], m[3]*n[1] + m[4]*n[4], m[3]*n[2] + m[4]*n[5] + m[5],
+	}
+}
+
+// Invert returns the inverse of m. ok is false if m is singular (or very nearly so), in which case the returned
+// transformation is meaningless.
+func (m Affine) Invert() (inv Affine, ok bool) {
+	det := m[0]*m[4] - m[1]*m[3]
+	if math.Abs(det) < 1e-12 {
+		return Affine{}, false
+	}
+	id := 1 / det
+	return Affine{
+		m[4] * id, -m[1] * id, (m[1]*m[5] - m[4]*m[2]) * id,
+		-m[3] * id, m[0] * id, (m[3]*m[2] - m[0]*m[5]) * id,
+	}, true
+}
+
+// Apply transforms the point (x, y).
+func (m Affine) Apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[1]*y + m[2], m[3]*x + m[4]*y + m[5]
+}
+
+// TransformRect returns the smallest integer rectangle containing all of r after transformation by m.
+func (m Affine) TransformRect(r image.Rectangle) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [4][2]int{{r.Min.X, r.Min.Y}, {r.Max.X, r.Min.Y}, {r.Min.X, r.Max.Y}, {r.Max.X, r.Max.Y}} {
+		x, y := m.Apply(float64(p[0]), float64(p[1]))
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	// The small epsilon keeps floating point noise (e.g. 99.99999999 after a rotation) from adding a row/column.
+	const eps = 1e-9
+	return image.Rect(int(math.Floor(minX+eps)), int(math.Floor(minY+eps)),
+		int(math.Ceil(maxX-eps)), int(math.Ceil(maxY-eps)))
+}
+
+// snapUnit rounds v to -1, 0 or 1 if it is within floating point noise of one of them.
+func snapUnit(v float64) float64 {
+	if r := math.Round(v); math.Abs(v-r) < 1e-12 {
+		return r
+	}
+	return v
+}
+
+// Interpolation selects how pixel values are computed at fractional source coordinates.
+type Interpolation int
+
+const (
+	// InterpNearest uses the value of the nearest pixel. It is the fastest, and the only lossless option, but
+	// produces jagged edges when rotating or scaling up and aliasing when scaling down.
+	InterpNearest Interpolation = iota
+	// InterpBilinear linearly interpolates between the 4 nearest pixels.
+	InterpBilinear
+	// InterpBicubic uses Catmull-Rom cubic interpolation over the 16 nearest pixels. It is the sharpest, and slowest,
+	// of the three.
+	InterpBicubic
+)
+
+// TransformOptions configures Transform and TransformFrom. The zero value is valid: nearest neighbor interpolation,
+// clamped edges, a zeroed (transparent black) background and no bounds expansion.
+type TransformOptions struct {
+	// Interp is the interpolation used when the transformation isn't lossless. Paletted sources always use
+	// InterpNearest, as palette indices can't be blended.
+	Interp Interpolation
+	// Edge is how interpolation reads pixels beyond the source image's edges, for destination pixels which map just
+	// inside them (those which map outside get Background). If it is EdgeConstant, Background is the constant.
+	Edge EdgeMode
+	// Background holds the pixelBytes used for destination pixels which don't map onto the source image.
+	// As with SetPixel, only the first n bytes of a pixel may be provided; the rest are zeroed.
+	Background []uint8
+	// Expand, if true, makes Transform size its result to contain the entire transformed source image (translated so
+	// that the result's bounds start at (0, 0)) rather than giving it the source image's bounds.
+	// It is ignored by TransformFrom.
+	Expand bool
+}
+
+// Transform returns a new Image, of the same underlying type as src, holding src transformed by m. See TransformFrom
+// for how pixels are computed. The result has src's bounds, unless opts.Expand is true.
+func Transform(src *Image, m Affine, opts TransformOptions) (*Image, error) {
+	r := src.Rect
+	if opts.Expand {
+		r = m.TransformRect(src.Rect)
+		m = TranslateAffine(float64(-r.Min.X), float64(-r.Min.Y)).Mul(m)
+		r = r.Sub(r.Min)
+	}
+	dst, err := NewImageLike(src, r)
+	if err != nil {
+		return nil, err
+	}
+	dst.TransformFrom(src, m, opts)
+	return dst, nil
+}
+
+// TransformFrom fills every pixel of img with src transformed by m (which maps src coordinates to img coordinates)
+// using inverse mapping: the center of each pixel of img is mapped back onto src and sampled there with opts.Interp.
+// Pixels which map outside src are filled with opts.Background.
+// If m is a multiple of a quarter turn and/or a flip, with a translation which keeps pixels aligned to the grid, the
+// pixels are copied directly without any interpolation (that is, losslessly and much faster) whatever opts.Interp is.
+// img and src must have the same underlying image type and must not share pixel data. Rows are processed in parallel.
+// If m is not invertible, img is filled with the background.
+func (img *Image) TransformFrom(src *Image, m Affine, opts TransformOptions) {
+	bg := make([]uint8, img.bpp)
+	copy(bg, opts.Background)
+
+	inv, ok := m.Invert()
+	if !ok {
+		img.resample(src, opts, bg, func(x, y float64) (float64, float64, bool) {
+			return 0, 0, false
+		})
+		return
+	}
+
+	if img.transformExact(src, inv, bg) {
+		return
+	}
+
+	img.resample(src, opts, bg, func(x, y float64) (float64, float64, bool) {
+		u, v := inv.Apply(x, y)
+		return u, v, true
+	})
+}
+
+// resample fills every pixel of img by sampling src (with opts.Interp and opts.Edge) at the point which inverse
+// returns for the pixel's center, or with bg if inverse returns false or a point outside src. inverse works in
+// continuous coordinates, in which pixel (x, y) covers [x,x+1)x[y,y+1). Rows are processed in parallel, so inverse
+// must be safe to call concurrently.
+// This is the shared core of the affine and perspective transformations.
+func (img *Image) resample(src *Image, opts TransformOptions, bg []uint8,
+	inverse func(x, y float64) (float64, float64, bool)) {
+	if src.indexed {
+		// Palette indices can't be blended.
+		opts.Interp = InterpNearest
+	}
+	s := NewSampler(src, opts.Interp, opts.Edge, bg...)
+	minX, minY := float64(src.Rect.Min.X), float64(src.Rect.Min.Y)
+	maxX, maxY := float64(src.Rect.Max.X), float64(src.Rect.Max.Y)
+	ch := img.channels()
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		px := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				u, v, ok := inverse(float64(x)+0.5, float64(y)+0.5)
+				if !ok || u < minX || v < minY || u >= maxX || v >= maxY {
+					copy(img.Pix[o:o+img.bpp], bg)
+				} else {
+					// Sample coordinates put pixel centers on integers.
+					s.Sample(u-0.5, v-0.5, px)
+					for c := 0; c < ch; c++ {
+						img.writeChannel(o+c*img.depth, px[c])
+					}
+				}
+				o += img.bpp
+			}
+		}
+	})
+}
+
+// transformExact performs the lossless fast path of TransformFrom, if inv (the inverse transformation) maps each
+// pixel of img exactly onto a pixel of src. It returns false, having done nothing, if it doesn't.
+func (img *Image) transformExact(src *Image, inv Affine, bg []uint8) bool {
+	var a [4]int
+	for i, j := range [4]int{0, 1, 3, 4} {
+		if inv[j] != -1 && inv[j] != 0 && inv[j] != 1 {
+			return false
+		}
+		a[i] = int(inv[j])
+	}
+	// Each row and column must have exactly one non-zero entry (so it's a quarter turn and/or a flip).
+	if (a[0] == 0) == (a[1] == 0) || (a[0] == 0) == (a[2] == 0) {
+		return false
+	}
+	// The source index for destination pixel x (center x+0.5) is a*(x+0.5) + b*(y+0.5) + c - 0.5, which is only an
+	// integer for integer x,y if the constant part is.
+	fx := float64(a[0]+a[1])/2 + inv[2] - 0.5
+	fy := float64(a[2]+a[3])/2 + inv[5] - 0.5
+	ox, oy := math.Round(fx), math.Round(fy)
+	if math.Abs(fx-ox) > 1e-9 || math.Abs(fy-oy) > 1e-9 {
+		return false
+	}
+	cx, cy := int(ox), int(oy)
+
+	parallelRows(img.Rect.Min.Y, img.Rect.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			o := img.offset(img.Rect.Min.X, y)
+			for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+				sx := a[0]*x + a[1]*y + cx
+				sy := a[2]*x + a[3]*y + cy
+				if sx < src.Rect.Min.X || sy < src.Rect.Min.Y || sx >= src.Rect.Max.X || sy >= src.Rect.Max.Y {
+					copy(img.Pix[o:o+img.bpp], bg)
+				} else {
+					so := src.offset(sx, sy)
+					copy(img.Pix[o:o+img.bpp], src.Pix[so:so+src.bpp])
+				}
+				o += img.bpp
+			}
+		}
+	})
+	return true
+}
+
+// Rotate90 returns a new Image holding src rotated a quarter turn clockwise. The result's bounds start at (0, 0).
+// This is lossless.
+func Rotate90(src *Image) (*Image, error) {
+	return rotateFlip(src, RotateAffine(math.Pi/2))
+}
+
+// Rotate180 returns a new Image holding src rotated a half turn. The result's bounds start at (0, 0).
+// This is lossless.
+func Rotate180(src *Image) (*Image, error) {
+	return rotateFlip(src, RotateAffine(math.Pi))
+}
+
+// Rotate270 returns a new Image holding src rotated a quarter turn counter-clockwise. The result's bounds start at
+// (0, 0). This is lossless.
+func Rotate270(src *Image) (*Image, error) {
+	return rotateFlip(src, RotateAffine(-math.Pi/2))
+}
+
+// FlipHorizontal returns a new Image holding src mirrored left-to-right. The result's bounds start at (0, 0).
+func FlipHorizontal(src *Image) (*Image, error) {
+	return rotateFlip(src, ScaleAffine(-1, 1))
+}
+
+// FlipVertical returns a new Image holding src mirrored top-to-bottom. The result's bounds start at (0, 0).
+func FlipVertical(src *Image) (*Image, error) {
+	return rotateFlip(src, ScaleAffine(1, -1))
+}
+
+// rotateFlip transforms src by the quarter turn and/or flip m, expanding the bounds (which always takes the exact
+// path, since the expanded bounds are on integer coordinates).
+func rotateFlip(src *Image, m Affine) (*Image, error) {
+	return Transform(src, m, TransformOptions{Expand: true})
+}
@@ -0,0 +1,173 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// triangleSubpixelBits is the number of fractional bits vertex coordinates are snapped to when rasterizing triangles,
+// so that the edge functions can be evaluated exactly (as GPUs do).
+const triangleSubpixelBits = 8
+
+// triangleMaxCoord bounds the vertex coordinates of triangles which are rasterized. Snapped to subpixels, coordinates
+// within ±2^21 keep the edge functions (which multiply differences of coordinates) well within int64.
+const triangleMaxCoord = 1 << 21
+
+// DrawFilledTriangle draws a filled-in triangle with vertices pts, of the color provided by pixelBytes. Pixels are
+// filled if their centers are inside the triangle, or on a top or left edge, so triangles sharing an edge (as in a
+// mesh) cover the pixels along it exactly once, with neither gaps nor overlap. Triangles with a vertex coordinate
+// beyond ±2^21 (2097152) aren't drawn.
+// pixelBytes may be the first n bytes of a pixel may be provided instead of all bytes.
+func (img *Image) DrawFilledTriangle(pts [3]Vec2, pixelBytes ...uint8) {
+	if len(pixelBytes) > img.bpp {
+		return
+	}
+	rasterTriangle(pts, img.Rect, func(x, y int, _ [3]float64) {
+		o := img.offset(x, y)
+		copy(img.Pix[o:o+len(pixelBytes)], pixelBytes)
+	})
+}
+
+// DrawShadedTriangle draws a filled-in triangle with vertices pts, covering the same pixels as DrawFilledTriangle, in
+// colors interpolated (barycentrically, with premultiplied alpha) from those of the vertices (Gouraud shading).
+// Colors which aren't fully opaque are blended over the existing pixels.
+func (img *Image) DrawShadedTriangle(pts [3]Vec2, colors [3]color.Color) {
+	var cs [3][4]float64
+	for i, c := range colors {
+		r, g, b, a := c.RGBA()
+		cs[i] = [4]float64{float64(r), float64(g), float64(b), float64(a)}
+	}
+	rasterTriangle(pts, img.Rect, func(x, y int, l [3]float64) {
+		var c [4]float64
+		for ch := range c {
+			c[ch] = l[0]*cs[0][ch] + l[1]*cs[1][ch] + l[2]*cs[2][ch]
+		}
+		img.paintPixel(img.offset(x, y), x, y, premulToNRGBA64(c))
+	})
+}
+
+// DrawShadedTriangles draws a mesh of shaded triangles (see DrawShadedTriangle), whose vertices are given by
+// vertices and colors (which must be the same length). Each three entries of indices are the indices of the vertices
+// of a triangle; if indices is nil, each three successive vertices are a triangle.
+func (img *Image) DrawShadedTriangles(vertices []Vec2, colors []color.Color, indices []int) {
+	if len(colors) < len(vertices) {
+		return
+	}
+	if indices == nil {
+		indices = make([]int, len(vertices))
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+	for i := 0; i+2 < len(indices); i += 3 {
+		a, b, c := indices[i], indices[i+1], indices[i+2]
+		if a < 0 || b < 0 || c < 0 || a >= len(vertices) || b >= len(vertices) || c >= len(vertices) {
+			continue
+		}
+		img.DrawShadedTriangle([3]Vec2{vertices[a], vertices[b], vertices[c]},
+			[3]color.Color{colors[a], colors[b], colors[c]})
+	}
+}
+
+// premulToNRGBA64 converts a premultiplied color with 16-bit channels (as from color.Color's RGBA) to a
+// color.NRGBA64.
+func premulToNRGBA64(c [4]float64) color.NRGBA64 {
+	a := math.Min(65535, math.Max(0, c[3]))
+	if a == 0 {
+		return color.NRGBA64{}
+	}
+	un := func(v float64) uint16 { return uint16(math.Min(65535, math.Max(0, v*65535/a+0.5))) }
+	return color.NRGBA64{R: un(c[0]), G: un(c[1]), B: un(c[2]), A: uint16(a + 0.5)}
+}
+
+// rasterTriangle calls pixel for each pixel within clip covered by the triangle with vertices pts (in either winding
+// order), with the barycentric coordinates of its center (the weights of each vertex, summing to 1). A pixel is
+// covered if its center is inside the triangle, or on a top edge (a horizontal edge above the rest of the triangle)
+// or left edge (one with the triangle to its right), so each pixel along an edge shared by two triangles is covered
+// by just one of them. Degenerate triangles, and those with a coordinate beyond ±triangleMaxCoord, cover nothing.
+func rasterTriangle(pts [3]Vec2, clip image.Rectangle, pixel func(x, y int, l [3]float64)) {
+	const one = 1 << triangleSubpixelBits
+	type point struct{ x, y int64 }
+	var v [3]point
+	for i, p := range pts {
+		// Beyond this (or NaN), the edge functions could overflow.
+		if !(math.Abs(p.X) <= triangleMaxCoord && math.Abs(p.Y) <= triangleMaxCoord) {
+			return
+		}
+		v[i] = point{int64(math.Round(p.X * one)), int64(math.Round(p.Y * one))}
+	}
+	orient := func(a, b, c point) int64 { return (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x) }
+	area := orient(v[0], v[1], v[2])
+	if area == 0 {
+		return
+	}
+	// Wind the triangle clockwise (on screen, with y down), so that points inside have positive edge functions.
+	// order maps the wound vertices back to those of pts.
+	order := [3]int{0, 1, 2}
+	if area < 0 {
+		v[1], v[2] = v[2], v[1]
+		order[1], order[2] = 2, 1
+		area = -area
+	}
+
+	minX, maxX := minMax3(v[0].x, v[1].x, v[2].x)
+	minY, maxY := minMax3(v[0].y, v[1].y, v[2].y)
+	// Pixels whose centers (x+0.5) are within the bounding box.
+	x0 := int(math.Max(float64(clip.Min.X), math.Ceil(float64(minX)/one-0.5)))
+	x1 := int(math.Min(float64(clip.Max.X-1), math.Floor(float64(maxX)/one-0.5)))
+	y0 := int(math.Max(float64(clip.Min.Y), math.Ceil(float64(minY)/one-0.5)))
+	y1 := int(math.Min(float64(clip.Max.Y-1), math.Floor(float64(maxY)/one-0.5)))
+	if x0 > x1 || y0 > y1 {
+		return
+	}
+
+	// Edge i is opposite vertex i. Its function is positive inside the triangle, and its bias excludes points exactly
+	// on it unless it is a top or left edge.
+	var a, b, bias [3]int64
+	for i := 0; i < 3; i++ {
+		p, q := v[(i+1)%3], v[(i+2)%3]
+		a[i], b[i] = p.y-q.y, q.x-p.x
+		if !(p.y == q.y && q.x > p.x || q.y < p.y) {
+			bias[i] = -1
+		}
+	}
+	fa := float64(area)
+	start := point{int64(x0)*one + one/2, int64(y0)*one + one/2}
+	var row [3]int64
+	for i := 0; i < 3; i++ {
+		row[i] = orient(v[(i+1)%3], v[(i+2)%3], start)
+	}
+	for y := y0; y <= y1; y++ {
+		w := row
+		for x := x0; x <= x1; x++ {
+			if w[0]+bias[0] >= 0 && w[1]+bias[1] >= 0 && w[2]+bias[2] >= 0 {
+				var l [3]float64
+				for i := 0; i < 3; i++ {
+					l[order[i]] = float64(w[i]) / fa
+				}
+				pixel(x, y, l)
+			}
+			for i := 0; i < 3; i++ {
+				w[i] += a[i] * one
+			}
+		}
+		for i := 0; i < 3; i++ {
+			row[i] += b[i] * one
+		}
+	}
+}
+
+// minMax3 returns the least and greatest of a, b and c.
+func minMax3(a, b, c int64) (int64, int64) {
+	min, max := a, a
+	for _, v := range [2]int64{b, c} {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
@@ -0,0 +1,108 @@
+package graphics
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// TrimRect returns the smallest rectangle containing every pixel of img which differs from border, such as the
+// content of a chart or scanned page within its margins. A pixel matches border if each of its channels is within
+// tolerance (in channel values, so up to 255 for 8-bit formats or 65535 for 16-bit ones) of border's. As with
+// SetPixel, border may be only the first n bytes of a pixel, in which case only the channels it covers are compared
+// (so the alpha channel can be ignored); if border is nil, the color of img's top-left pixel is used. If every pixel
+// matches, the empty rectangle is returned.
+func TrimRect(img *Image, border []uint8, tolerance int) image.Rectangle {
+	if len(border) > img.bpp {
+		return img.Rect
+	}
+	if img.Rect.Empty() {
+		return image.Rectangle{}
+	}
+	if border == nil {
+		o := img.offset(img.Rect.Min.X, img.Rect.Min.Y)
+		border = img.Pix[o : o+img.bpp]
+	}
+	vals := img.bytesToValues(border)[:(len(border)+img.depth-1)/img.depth]
+	tol := float64(tolerance)
+	return img.trimRect(func(o int) bool {
+		for c, v := range vals {
+			if math.Abs(img.readChannel(o+c*img.depth)-v) > tol {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// TrimTransparentRect returns the smallest rectangle containing every pixel of img whose alpha is greater than
+// tolerance (in channel values, as for TrimRect). If img's format has no alpha channel, it is all content, so
+// img.Rect is returned; if every pixel is transparent, the empty rectangle is returned.
+func TrimTransparentRect(img *Image, tolerance int) image.Rectangle {
+	if img.alpha < 0 {
+		return img.Rect
+	}
+	a, tol := img.alpha*img.depth, float64(tolerance)
+	return img.trimRect(func(o int) bool { return img.readChannel(o+a) > tol })
+}
+
+// Trim returns the part of img within TrimRect(img, border, tolerance), as a sub-image sharing its pixels (see
+// SubImage). An error is returned if the underlying image type has no SubImage method.
+func Trim(img *Image, border []uint8, tolerance int) (*Image, error) {
+	return trimmed(img, TrimRect(img, border, tolerance))
+}
+
+// TrimTransparent returns the part of img within TrimTransparentRect(img, tolerance), as a sub-image sharing its
+// pixels (see SubImage). An error is returned if the underlying image type has no SubImage method.
+func TrimTransparent(img *Image, tolerance int) (*Image, error) {
+	return trimmed(img, TrimTransparentRect(img, tolerance))
+}
+
+// trimmed returns the sub-image of img within r.
+func trimmed(img *Image, r image.Rectangle) (*Image, error) {
+	sub, ok := img.SubImage(r).(*Image)
+	if !ok {
+		return nil, errors.New("image type has no SubImage method")
+	}
+	return sub, nil
+}
+
+// trimRect returns the smallest rectangle containing every pixel of img for which content (given the pixel's offset
+// in Pix) is true. Rows are scanned in from the top and bottom, and then columns in from the sides, within the rows
+// left, stopping at the first content found from each direction.
+func (img *Image) trimRect(content func(o int) bool) image.Rectangle {
+	r := img.Rect
+	rowHas := func(y, x0, x1 int) bool {
+		for x, o := x0, img.offset(x0, y); x < x1; x, o = x+1, o+img.bpp {
+			if content(o) {
+				return true
+			}
+		}
+		return false
+	}
+	colHas := func(x, y0, y1 int) bool {
+		for y, o := y0, img.offset(x, y0); y < y1; y, o = y+1, o+img.Stride {
+			if content(o) {
+				return true
+			}
+		}
+		return false
+	}
+	for r.Min.Y < r.Max.Y && !rowHas(r.Min.Y, r.Min.X, r.Max.X) {
+		r.Min.Y++
+	}
+	if r.Min.Y == r.Max.Y {
+		return image.Rectangle{}
+	}
+	for !rowHas(r.Max.Y-1, r.Min.X, r.Max.X) {
+		r.Max.Y--
+	}
+	// There is content in the remaining rows, so these stop within them.
+	for !colHas(r.Min.X, r.Min.Y, r.Max.Y) {
+		r.Min.X++
+	}
+	for !colHas(r.Max.X-1, r.Min.Y, r.Max.Y) {
+		r.Max.X--
+	}
+	return r
+}
@@ -21,6 +21,16 @@ type Image struct {
 	// Bytes per pixel. Calculated during NewImage, and used to ensure provided pixelBytes parameters in received
 	// methods are <= the number of bytes used for each pixel in the image format.
 	bpp int
+	// Bytes per channel (1, or 2 for the 16-bit formats, whose channels are stored big-endian). Channels per pixel is
+	// bpp / depth.
+	depth int
+	// Index of the alpha channel within a pixel, or -1 if the format has no alpha channel.
+	alpha int
+	// Whether the color channels are alpha-premultiplied (as with image.RGBA, but not image.NRGBA).
+	premul bool
+	// Whether each pixel is an index into a palette (as with image.Paletted) rather than channel values, so colors
+	// must be read and written via At and Set.
+	indexed bool
 }
 
 // NewImage is a factory method to create an Image from an Imager.
@@ -50,7 +60,7 @@ func NewImage(imgr Imager) (*Image, error) {
 				img.Pix = pix
 				img.Stride = stride
 				img.Rect = rect
-				img.bpp = len(pix) / (rect.Dx() * rect.Dy())
+				img.setFormat()
 				return img, nil
 			}
 		}
@@ -59,6 +69,157 @@ func NewImage(imgr Imager) (*Image, error) {
 	return nil, fmt.Errorf("unknown image type %T", imgr)
 }
 
+// setFormat fills in bpp, depth, alpha and premul based on the underlying image type. Unknown types are assumed to
+// have 8-bit channels, with the bytes per pixel derived from the Pix length and an alpha channel last if there are 4.
+func (img *Image) setFormat() {
+	img.depth, img.alpha, img.premul, img.indexed = 1, -1, false, false
+	switch img.Imager.(type) {
+	case *image.RGBA:
+		img.bpp, img.alpha, img.premul = 4, 3, true
+	case *image.NRGBA:
+		img.bpp, img.alpha = 4, 3
+	case *image.RGBA64:
+		img.bpp, img.depth, img.alpha, img.premul = 8, 2, 3, true
+	case *image.NRGBA64:
+		img.bpp, img.depth, img.alpha = 8, 2, 3
+	case *image.Gray:
+		img.bpp = 1
+	case *image.Gray16:
+		img.bpp, img.depth = 2, 2
+	case *image.Alpha:
+		img.bpp, img.alpha, img.premul = 1, 0, true
+	case *image.Alpha16:
+		img.bpp, img.depth, img.alpha, img.premul = 2, 2, 0, true
+	case *image.CMYK:
+		img.bpp = 4
+	case *image.Paletted:
+		img.bpp, img.indexed = 1, true
+	default:
+		// Note this over-counts for sub-images, whose Pix runs to the end of the parent's, hence the known types above.
+		if n := img.Rect.Dx() * img.Rect.Dy(); n > 0 {
+			img.bpp = len(img.Pix) / n
+		}
+		if img.bpp == 4 {
+			img.alpha = 3
+		}
+	}
+}
+
+// NewImageLike creates a new, zeroed Image with bounds r and the same underlying image type as like.
+// Only the image types from the standard image package that NewImage supports (RGBA, NRGBA, RGBA64, NRGBA64, Gray,
+// Gray16, Alpha, Alpha16 and CMYK) can be created; any other type returns an error.
+func NewImageLike(like *Image, r image.Rectangle) (*Image, error) {
+	var imgr Imager
+	switch like.Imager.(type) {
+	case *image.RGBA:
+		imgr = image.NewRGBA(r)
+	case *image.NRGBA:
+		imgr = image.NewNRGBA(r)
+	case *image.RGBA64:
+		imgr = image.NewRGBA64(r)
+	case *image.NRGBA64:
+		imgr = image.NewNRGBA64(r)
+	case *image.Gray:
+		imgr = image.NewGray(r)
+	case *image.Gray16:
+		imgr = image.NewGray16(r)
+	case *image.Alpha:
+		imgr = image.NewAlpha(r)
+	case *image.Alpha16:
+		imgr = image.NewAlpha16(r)
+	case *image.CMYK:
+		imgr = image.NewCMYK(r)
+	default:
+		return nil, fmt.Errorf("cannot create an image like unknown image type %T", like.Imager)
+	}
+	return NewImage(imgr)
+}
+
+// SubImage returns an Image of the part of img visible through r (intersected with img's bounds), sharing its
+// pixels, from the underlying image's SubImage method. It returns an *Image (as an image.Image, so that Image is a
+// SubImager and can be passed straight to ResizeMaintain), or nil if the underlying image type has no SubImage method.
+func (img *Image) SubImage(r image.Rectangle) image.Image {
+	s, ok := img.Imager.(SubImager)
+	if !ok {
+		return nil
+	}
+	imgr, ok := s.SubImage(r).(Imager)
+	if !ok {
+		return nil
+	}
+	sub := *img
+	sub.Imager = imgr
+	// The format is the parent's, which NewImage can't always recover from a sub-image (see setFormat).
+	sub.Rect = r.Intersect(img.Rect)
+	if sub.Rect.Empty() {
+		sub.Rect, sub.Pix = image.Rectangle{}, nil
+	} else {
+		sub.Pix = img.Pix[img.offset(sub.Rect.Min.X, sub.Rect.Min.Y):]
+	}
+	return &sub
+}
+
+// channels returns the number of channels per pixel.
+func (img *Image) channels() int {
+	return img.bpp / img.depth
+}
+
+// maxValue returns the maximum value of a channel (255 or 65535).
+func (img *Image) maxValue() float64 {
+	if img.depth == 2 {
+		return 65535
+	}
+	return 255
+}
+
+// offset returns the index in Pix of the first byte of the pixel at (x, y), without any bounds checking.
+// Unlike PixOffset, it doesn't go through the Imager interface, so it's cheap enough to call per pixel.
+func (img *Image) offset(x, y int) int {
+	return (y-img.Rect.Min.Y)*img.Stride + (x-img.Rect.Min.X)*img.bpp
+}
+
+// readChannel returns the channel value whose first byte is Pix[o].
+func (img *Image) readChannel(o int) float64 {
+	if img.depth == 2 {
+		return float64(uint16(img.Pix[o])<<8 | uint16(img.Pix[o+1]))
+	}
+	return float64(img.Pix[o])
+}
+
+// writeChannel rounds and clamps v to the channel range and stores it with its first byte at Pix[o].
+func (img *Image) writeChannel(o int, v float64) {
+	if v <= 0 {
+		v = 0
+	} else if m := img.maxValue(); v >= m {
+		v = m
+	}
+	if img.depth == 2 {
+		u := uint16(v + 0.5)
+		img.Pix[o], img.Pix[o+1] = uint8(u>>8), uint8(u)
+		return
+	}
+	img.Pix[o] = uint8(v + 0.5)
+}
+
+// bytesToValues decodes pixelBytes b into channel values. As with SetPixel, b may be only the first n bytes of a
+// pixel, in which case the remaining bytes are taken to be zero.
+func (img *Image) bytesToValues(b []uint8) []float64 {
+	vals := make([]float64, img.channels())
+	for c := range vals {
+		o := c * img.depth
+		if o < len(b) {
+			vals[c] = float64(b[o])
+		}
+		if img.depth == 2 {
+			vals[c] *= 256
+			if o+1 < len(b) {
+				vals[c] += float64(b[o+1])
+			}
+		}
+	}
+	return vals
+}
+
 // You probably don't want to use this. Create a graphics.Image instead using the NewImage factory. This will allow
 // the use of methods such as DrawFilledCircle
 type Imager interface {
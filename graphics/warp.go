@@ -0,0 +1,164 @@
+package graphics
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// Vec2 is a point (or vector) with floating point coordinates.
+type Vec2 struct {
+	X, Y float64
+}
+
+// Homography is a 3x3 projective transformation matrix, in row-major order. It maps (x, y) to
+// ((h[0]*x + h[1]*y + h[2]) / w, (h[3]*x + h[4]*y + h[5]) / w), where w = h[6]*x + h[7]*y + h[8].
+// As with Affine, coordinates are image (pixel) coordinates.
+type Homography [9]float64
+
+// NewHomography computes the homography which maps each of the four from points onto the corresponding to point.
+// Points are continuous coordinates, so the corners of a w x h image with bounds starting at (0, 0) are (0, 0),
+// (w, 0), (w, h) and (0, h). An error is returned if no such homography exists, which is the case if three of the
+// points (of either set) are collinear.
+func NewHomography(from, to [4]Vec2) (Homography, error) {
+	// Each correspondence gives two rows of the 8x8 system A*h = b, where h is the matrix with h[8] fixed at 1:
+	//   x*h0 + y*h1 + h2 - x*X*h6 - y*X*h7 = X
+	//   x*h3 + y*h4 + h5 - x*Y*h6 - y*Y*h7 = Y
+	var a [8][9]float64
+	for i := 0; i < 4; i++ {
+		x, y, X, Y := from[i].X, from[i].Y, to[i].X, to[i].Y
+		a[2*i] = [9]float64{x, y, 1, 0, 0, 0, -x * X, -y * X, X}
+		a[2*i+1] = [9]float64{0, 0, 0, x, y, 1, -x * Y, -y * Y, Y}
+	}
+
+	// Gaussian elimination with partial pivoting on the augmented matrix.
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-10 {
+			return Homography{}, errors.New("degenerate points: no homography maps them")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < 8; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k < 9; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+		}
+	}
+	var h Homography
+	h[8] = 1
+	for row := 7; row >= 0; row-- {
+		v := a[row][8]
+		for k := row + 1; k < 8; k++ {
+			v -= a[row][k] * h[k]
+		}
+		h[row] = v / a[row][row]
+	}
+	return h, nil
+}
+
+// HomographyFromAffine returns the homography equivalent to the affine transformation m.
+func HomographyFromAffine(m Affine) Homography {
+	return Homography{m[0], m[1], m[2], m[3], m[4], m[5], 0, 0, 1}
+}
+
+// Mul returns the product h*n, which is the transformation that applies n and then h.
+func (h Homography) Mul(n Homography) Homography {
+	var r Homography
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i*3+j] = h[i*3]*n[j] + h[i*3+1]*n[3+j] + h[i*3+2]*n[6+j]
+		}
+	}
+	return r
+}
+
+// Invert returns the inverse of h. ok is false if h is singular (or very nearly so), in which case the returned
+// transformation is meaningless.
+func (h Homography) Invert() (inv Homography, ok bool) {
+	// The adjugate over the determinant.
+	inv = Homography{
+		h[4]*h[8] - h[5]*h[7], h[2]*h[7] - h[1]*h[8], h[1]*h[5] - h[2]*h[4],
+		h[5]*h[6] - h[3]*h[8], h[0]*h[8] - h[2]*h[6], h[2]*h[3] - h[0]*h[5],
+		h[3]*h[7] - h[4]*h[6], h[1]*h[6] - h[0]*h[7], h[0]*h[4] - h[1]*h[3],
+	}
+	det := h[0]*inv[0] + h[1]*inv[3] + h[2]*inv[6]
+	if math.Abs(det) < 1e-12 {
+		return Homography{}, false
+	}
+	for i := range inv {
+		inv[i] /= det
+	}
+	return inv, true
+}
+
+// Apply transforms the point (x, y). ok is false if the point maps to infinity or is behind the projection (w <= 0),
+// in which case x and y are meaningless.
+func (h Homography) Apply(x, y float64) (tx, ty float64, ok bool) {
+	w := h[6]*x + h[7]*y + h[8]
+	if w <= 1e-12 {
+		return 0, 0, false
+	}
+	return (h[0]*x + h[1]*y + h[2]) / w, (h[3]*x + h[4]*y + h[5]) / w, true
+}
+
+// Warp returns a new Image, of the same underlying type as src and with bounds r, holding src transformed by the
+// homography h. See WarpFrom for how pixels are computed.
+func Warp(src *Image, h Homography, r image.Rectangle, opts TransformOptions) (*Image, error) {
+	dst, err := NewImageLike(src, r)
+	if err != nil {
+		return nil, err
+	}
+	dst.WarpFrom(src, h, opts)
+	return dst, nil
+}
+
+// Rectify returns a new width x height Image, of the same underlying type as src, holding the quadrilateral region
+// of src with the given corners stretched to fill it. The corners are in the order top-left, top-right,
+// bottom-right, bottom-left (of the result), and are continuous coordinates (see NewHomography).
+// This is what's needed to straighten out a photographed document or screen, given where its corners are.
+func Rectify(src *Image, corners [4]Vec2, width, height int, opts TransformOptions) (*Image, error) {
+	w, ht := float64(width), float64(height)
+	h, err := NewHomography(corners, [4]Vec2{{0, 0}, {w, 0}, {w, ht}, {0, ht}})
+	if err != nil {
+		return nil, err
+	}
+	return Warp(src, h, image.Rect(0, 0, width, height), opts)
+}
+
+// WarpFrom fills every pixel of img with src transformed by the homography h (which maps src coordinates to img
+// coordinates), using inverse mapping exactly as TransformFrom does: each pixel center of img is mapped back onto src
+// and sampled there with opts.Interp, with pixels which map outside src (or from behind the projection) filled with
+// opts.Background. opts.Expand is ignored.
+// img and src must have the same underlying image type and must not share pixel data. Rows are processed in parallel.
+// If h is not invertible, img is filled with the background.
+func (img *Image) WarpFrom(src *Image, h Homography, opts TransformOptions) {
+	bg := make([]uint8, img.bpp)
+	copy(bg, opts.Background)
+
+	inv, ok := h.Invert()
+	if !ok {
+		img.resample(src, opts, bg, func(x, y float64) (float64, float64, bool) {
+			return 0, 0, false
+		})
+		return
+	}
+	// An affine homography can take TransformFrom's lossless path (and skips the per-pixel division otherwise).
+	if inv[6] == 0 && inv[7] == 0 && inv[8] != 0 {
+		m := Affine{inv[0], inv[1], inv[2], inv[3], inv[4], inv[5]}
+		for i := range m {
+			m[i] /= inv[8]
+		}
+		if fwd, ok := m.Invert(); ok {
+			img.TransformFrom(src, fwd, opts)
+			return
+		}
+	}
+
+	img.resample(src, opts, bg, inv.Apply)
+}
@@ -30,3 +30,10 @@ func InitRandom() {
 	}
 	rand.Seed(int64(binary.LittleEndian.Uint64(b[:])))
 }
+
+// NewRandom returns a new, independent *rand.Rand seeded with seed, for when results need to be reproducible. It is
+// unaffected by (and doesn't affect) InitRandom and the global math/rand source, and, like any *rand.Rand, isn't safe
+// for concurrent use.
+func NewRandom(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}